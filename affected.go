@@ -0,0 +1,148 @@
+package dgql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AffectedOperation is a generated operation whose document differs between
+// two schemas.
+type AffectedOperation struct {
+	// Operation is one of OperationQuery, OperationMutation and
+	// OperationSubscription.
+	Operation string
+	Name      string
+	// Before and After are the generated documents, After is empty when the
+	// operation can no longer be built.
+	Before string
+	After  string
+	// Err tells why the operation can no longer be built.
+	Err error
+	// Variables lists the variables whose requiredness changed.
+	Variables []VariableChange
+}
+
+// Invalid reports whether the operation can no longer be built.
+func (o AffectedOperation) Invalid() bool {
+	return o.Err != nil
+}
+
+func (o AffectedOperation) String() string {
+	if o.Invalid() {
+		return fmt.Sprintf("%s %s is invalid: %s", o.Operation, o.Name, o.Err)
+	}
+	result := fmt.Sprintf("%s %s changed", o.Operation, o.Name)
+	for _, variable := range o.Variables {
+		result += "\n  " + variable.String()
+	}
+	return result
+}
+
+// VariableChange is a variable of an operation which became required or
+// optional. A variable which is not declared counts as optional.
+type VariableChange struct {
+	Name string
+	// Before and After are the declared types, empty when the variable is
+	// not declared.
+	Before string
+	After  string
+}
+
+// Required reports whether the variable is required after the change.
+func (v VariableChange) Required() bool {
+	return strings.HasSuffix(v.After, "!")
+}
+
+func (v VariableChange) String() string {
+	switch {
+	case v.Before == "":
+		return fmt.Sprintf("$%s: %s was added", v.Name, v.After)
+	case v.After == "":
+		return fmt.Sprintf("$%s: %s was removed", v.Name, v.Before)
+	case v.Required():
+		return fmt.Sprintf("$%s became required, %s to %s", v.Name, v.Before, v.After)
+	}
+	return fmt.Sprintf("$%s became optional, %s to %s", v.Name, v.Before, v.After)
+}
+
+// AffectedOperations builds the documents of every query, mutation and
+// subscription of before as a client would, and reports the ones which
+// result in a different document or can not be built against after.
+// Operations only present in after are not reported. The options are those
+// the client is created with, only WithMaxDepth changes the documents.
+func AffectedOperations(before *Introspection, after *Introspection, opts ...Option) []AffectedOperation {
+	options := newOptions(opts)
+	beforeSchema, afterSchema := newSchema(before.Schema), newSchema(after.Schema)
+	affected := make([]AffectedOperation, 0)
+	for _, operation := range []string{OperationQuery, OperationMutation, OperationSubscription} {
+		beforeDocuments := beforeSchema.parseOperations(operation, options.maxDepth)
+		afterDocuments := afterSchema.parseOperations(operation, options.maxDepth)
+		names := make([]string, 0, len(beforeDocuments))
+		for name := range beforeDocuments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			result := AffectedOperation{
+				Operation: operation,
+				Name:      name,
+				Before:    beforeDocuments[name],
+			}
+			document, ok := afterDocuments[name]
+			if !ok {
+				// build it again for the error parseOperations left out
+				_, _, result.Err = afterSchema.Document(operation, name, WithDepth(options.maxDepth))
+				affected = append(affected, result)
+				continue
+			}
+			if document == result.Before {
+				continue
+			}
+			result.After = document
+			result.Variables = variableChanges(beforeSchema.variables(operation, name), afterSchema.variables(operation, name))
+			affected = append(affected, result)
+		}
+	}
+	return affected
+}
+
+// variables returns the variables declared by the document of an operation,
+// which are the arguments of its root field.
+func (s *Schema) variables(operation string, operationName string) []*ArgumentDefinition {
+	root := s.objects[s.roots[operation]]
+	if root == nil {
+		return nil
+	}
+	field := root.field(operationName)
+	if field == nil {
+		return nil
+	}
+	return field.Args
+}
+
+// variableChanges lists the variables which are required on one side only.
+func variableChanges(before []*ArgumentDefinition, after []*ArgumentDefinition) []VariableChange {
+	afterTypes := make(map[string]*TypeRef, len(after))
+	for _, arg := range after {
+		afterTypes[arg.Name] = arg.Type
+	}
+	beforeTypes := make(map[string]*TypeRef, len(before))
+	changes := make([]VariableChange, 0)
+	for _, arg := range before {
+		beforeTypes[arg.Name] = arg.Type
+		afterType, ok := afterTypes[arg.Name]
+		switch {
+		case !ok && arg.Type.IsNonNull():
+			changes = append(changes, VariableChange{Name: arg.Name, Before: arg.Type.String()})
+		case ok && arg.Type.IsNonNull() != afterType.IsNonNull():
+			changes = append(changes, VariableChange{Name: arg.Name, Before: arg.Type.String(), After: afterType.String()})
+		}
+	}
+	for _, arg := range after {
+		if _, ok := beforeTypes[arg.Name]; !ok && arg.Type.IsNonNull() {
+			changes = append(changes, VariableChange{Name: arg.Name, After: arg.Type.String()})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,61 @@
+package dgql_test
+
+import (
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAffectedOperations(t *testing.T) {
+	before, err := dgql.ParseSDL(`
+type Query {
+  user(id: ID, locale: String!): User
+  users: [User]
+  version: String
+  legacy: String
+}
+type Mutation { rename(id: ID!, name: String): User }
+type User { name: String }
+`)
+	if !assert.NoError(t, err, "Error parsing schema") {
+		return
+	}
+	after, err := dgql.ParseSDL(`
+type Query {
+  user(id: ID!, first: Int!, locale: String): User
+  users: [User]
+  version: String
+  added: String
+}
+type Mutation { rename(id: ID!, name: String!): User }
+type User { name: String avatar: String }
+`)
+	if !assert.NoError(t, err, "Error parsing schema") {
+		return
+	}
+	affected := dgql.AffectedOperations(&dgql.Introspection{Schema: before}, &dgql.Introspection{Schema: after})
+	if !assert.Len(t, affected, 4) {
+		return
+	}
+
+	assert.Equal(t, "legacy", affected[0].Name)
+	assert.True(t, affected[0].Invalid())
+	assert.EqualError(t, affected[0].Err, "query legacy not found")
+
+	assert.Equal(t, "user", affected[1].Name)
+	assert.Equal(t, "query user($id: ID, $locale: String!) { user(id: $id, locale: $locale) { name } }", affected[1].Before)
+	assert.Equal(t, "query user($id: ID!, $first: Int!, $locale: String) { user(id: $id, first: $first, locale: $locale) { name avatar } }", affected[1].After)
+	assert.Equal(t, []dgql.VariableChange{
+		{Name: "id", Before: "ID", After: "ID!"},
+		{Name: "locale", Before: "String!", After: "String"},
+		{Name: "first", After: "Int!"},
+	}, affected[1].Variables)
+
+	assert.Equal(t, "users", affected[2].Name)
+	assert.Empty(t, affected[2].Variables)
+
+	assert.Equal(t, dgql.OperationMutation, affected[3].Operation)
+	assert.Equal(t, `mutation rename changed
+  $name became required, String to String!`, affected[3].String())
+}
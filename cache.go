@@ -0,0 +1,186 @@
+package dgql
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpCache keeps the responses to GET queries as a private http cache would,
+// following their Cache-Control, Expires and ETag headers. It holds at most
+// maxEntries responses and drops the least recently used one first.
+type httpCache struct {
+	maxEntries int
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	// order holds the cached responses, most recently used first
+	order *list.List
+}
+
+type cachedResponse struct {
+	key        string
+	statusCode int
+	header     http.Header
+	body       []byte
+	etag       string
+	expires    time.Time
+}
+
+func newHTTPCache(maxEntries int) *httpCache {
+	return &httpCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// cacheKey identifies a request by its url and headers, so responses to
+// requests with different credentials are never mixed up.
+func cacheKey(target string, header http.Header) string {
+	var key strings.Builder
+	key.WriteString(target)
+	key.WriteString("\n")
+	header.Write(&key)
+	return key.String()
+}
+
+func (c *cachedResponse) fresh() bool {
+	return time.Now().Before(c.expires)
+}
+
+// response returns the cached response for parseResponse.
+func (c *cachedResponse) response() *http.Response {
+	return &http.Response{
+		StatusCode: c.statusCode,
+		Status:     strconv.Itoa(c.statusCode) + " " + http.StatusText(c.statusCode),
+		Header:     c.header.Clone(),
+	}
+}
+
+func (c *httpCache) get(key string) *cachedResponse {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cachedResponse)
+}
+
+// put caches a response unless its status or headers forbid it.
+func (c *httpCache) put(key string, resp *http.Response, body []byte) {
+	if c == nil || resp.StatusCode != http.StatusOK {
+		c.remove(key)
+		return
+	}
+	cached := &cachedResponse{
+		key:        key,
+		statusCode: resp.StatusCode,
+		header:     resp.Header.Clone(),
+		body:       body,
+	}
+	if !cached.update(resp.Header) {
+		c.remove(key)
+		return
+	}
+	c.store(cached)
+}
+
+// revalidate refreshes a cached response with the headers of the 304 Not
+// Modified response the server answered its ETag with.
+func (c *httpCache) revalidate(key string, cached *cachedResponse, resp *http.Response) *cachedResponse {
+	header := cached.header.Clone()
+	for name, values := range resp.Header {
+		header[name] = values
+	}
+	revalidated := &cachedResponse{
+		key:        key,
+		statusCode: cached.statusCode,
+		header:     header,
+		body:       cached.body,
+	}
+	if revalidated.update(header) {
+		c.store(revalidated)
+	} else {
+		c.remove(key)
+	}
+	return revalidated
+}
+
+// update sets the ETag and expiry of a response from its headers and reports
+// whether it may be cached. A response with no-cache or without a lifetime is
+// only cached when it can be revalidated by its ETag.
+func (c *cachedResponse) update(header http.Header) bool {
+	c.etag = header.Get("ETag")
+	now := time.Now()
+	c.expires = now
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			seconds = 0
+		}
+		age, _ := strconv.Atoi(header.Get("Age"))
+		c.expires = now.Add(time.Duration(seconds-age) * time.Second)
+	} else if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			c.expires = t
+		}
+	}
+	if _, ok := directives["no-cache"]; ok {
+		c.expires = now
+	}
+	return c.etag != "" || c.fresh()
+}
+
+func (c *httpCache) store(cached *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[cached.key]; ok {
+		element.Value = cached
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[cached.key] = c.order.PushFront(cached)
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+func (c *httpCache) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// parseCacheControl returns the directives of a Cache-Control header by
+// their lower case names, with the unquoted value of directives having one.
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(value, ",") {
+		name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(argument, `"`)
+	}
+	return directives
+}
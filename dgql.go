@@ -1,146 +1,218 @@
 package dgql
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"mime/multipart"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type GraphqlClient struct {
-	mutationDocumentMap map[string]string
-	queryDocumentMap    map[string]string
-	DefaultHeaders      map[string]string
-	Endpoint            string
-	Client              *resty.Client
+	// state is replaced when a refresh finds a new schema
+	state                 atomic.Pointer[schemaState]
+	refresher             *refresher
+	maxDepth              int
+	subscriptionTransport SubscriptionTransport
+	reconnectAttempts     int
+	reconnectDelay        time.Duration
+	getQueries            bool
+	maxURLLength          int
+	cache                 *httpCache
+	persisted             *persistedQueries
+	DefaultHeaders        map[string]string
+	Endpoint              string
+	// SubscriptionEndpoint is the websocket url used by Subscribe, it is
+	// derived from Endpoint when empty.
+	SubscriptionEndpoint string
+	Client               *resty.Client
 }
 
-func (c *GraphqlClient) Query(ctx context.Context, operationName string, variables interface{}, headers *map[string]string) (*gjson.Result, *http.Header, error) {
-	document := c.queryDocumentMap[operationName]
-	return c.Raw(ctx, document, operationName, variables, headers)
+// Document returns the document generated for an operation together with the
+// object fields that were left out of it, see Schema.Document.
+func (c *GraphqlClient) Document(operation string, operationName string, opts ...CallOption) (string, []string, error) {
+	// the client's depth goes first so that a per call depth overrides it
+	opts = append([]CallOption{WithDepth(c.maxDepth)}, opts...)
+	return c.state.Load().schema.Document(operation, operationName, opts...)
 }
 
-func (c *GraphqlClient) Mutation(ctx context.Context, operationName string, variables interface{}, headers *map[string]string) (*gjson.Result, *http.Header, error) {
-	document := c.mutationDocumentMap[operationName]
-	return c.Raw(ctx, document, operationName, variables, headers)
+// document returns the cached document of an operation when the call does
+// not change how it is generated.
+func (c *GraphqlClient) document(operation string, operationName string, opts []CallOption) (string, error) {
+	if len(opts) == 0 {
+		state := c.state.Load()
+		var documentMap map[string]string
+		switch operation {
+		case OperationQuery:
+			documentMap = state.queryDocumentMap
+		case OperationMutation:
+			documentMap = state.mutationDocumentMap
+		case OperationSubscription:
+			documentMap = state.subscriptionDocumentMap
+		}
+		if document, ok := documentMap[operationName]; ok {
+			return document, nil
+		}
+	}
+	document, _, err := c.Document(operation, operationName, opts...)
+	return document, err
 }
 
-func (c *GraphqlClient) UploadMutation(ctx context.Context, operationName string, variables interface{}, headers *map[string]string, files []FileConfig) (*gjson.Result, *http.Header, error) {
-	document := c.mutationDocumentMap[operationName]
-	return c.RawUpload(ctx, document, operationName, variables, headers, files)
+func (c *GraphqlClient) Query(ctx context.Context, operationName string, variables interface{}, headers *map[string]string, opts ...CallOption) (*gjson.Result, *http.Header, error) {
+	document, err := c.document(OperationQuery, operationName, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, header, err := c.send(ctx, OperationQuery, document, operationName, variables, headers)
+	c.refreshOnError(err)
+	return data, header, err
 }
 
-func (c *GraphqlClient) Raw(ctx context.Context, document string, operationName string, variables interface{}, headers *map[string]string) (*gjson.Result, *http.Header, error) {
-	request := c.Client.R()
-	if ctx != nil {
-		request.SetContext(ctx)
-	}
-	for k, v := range c.DefaultHeaders {
-		request.SetHeader(k, v)
-	}
-	if headers != nil {
-		for k, v := range *headers {
-			request.SetHeader(k, v)
-		}
+func (c *GraphqlClient) Mutation(ctx context.Context, operationName string, variables interface{}, headers *map[string]string, opts ...CallOption) (*gjson.Result, *http.Header, error) {
+	document, err := c.document(OperationMutation, operationName, opts)
+	if err != nil {
+		return nil, nil, err
 	}
+	data, header, err := c.send(ctx, OperationMutation, document, operationName, variables, headers)
+	c.refreshOnError(err)
+	return data, header, err
+}
 
-	resp, err := request.
-		SetHeader("Content-Type", "application/json").
-		SetBody(map[string]interface{}{
-			"query":         document,
-			"operationName": operationName,
-			"variables":     variables,
-		}).Post(c.Endpoint)
+// UploadMutation sends a mutation with files as a multipart request. Besides
+// files, every File found in variables at an argument or input field of a
+// scalar type like Upload is sent.
+func (c *GraphqlClient) UploadMutation(ctx context.Context, operationName string, variables interface{}, headers *map[string]string, files []FileConfig, opts ...CallOption) (*gjson.Result, *http.Header, error) {
+	document, err := c.document(OperationMutation, operationName, opts)
 	if err != nil {
 		return nil, nil, err
 	}
-	result := gjson.ParseBytes(resp.Body())
-	gqlerror := result.Get("errors")
-	if gqlerror.Exists() {
-		return nil, nil, fmt.Errorf("%v", gqlerror)
+	found, err := c.state.Load().schema.files(OperationMutation, operationName, variables)
+	if err != nil {
+		return nil, nil, err
 	}
-	gqldata := result.Get("data")
-	if !gqldata.Exists() {
-		return nil, nil, fmt.Errorf("data not found")
+	files = append(append([]FileConfig{}, files...), found...)
+	data, header, err := c.RawUpload(ctx, document, operationName, variables, headers, files)
+	c.refreshOnError(err)
+	return data, header, err
+}
+
+// Raw sends a document as it is. With WithGetQueries the document is parsed
+// to find out whether the operation is a query, anything else is posted.
+func (c *GraphqlClient) Raw(ctx context.Context, document string, operationName string, variables interface{}, headers *map[string]string) (*gjson.Result, *http.Header, error) {
+	var operation string
+	if c.getQueries {
+		operation = operationType(document, operationName)
 	}
-	respHeader := resp.Header()
-	return &gqldata, &respHeader, nil
+	return c.send(ctx, operation, document, operationName, variables, headers)
 }
 
-type FileConfig struct {
-	Bytes *[]byte
-	Path  string
+// operations is the json body of a graphql request, and the operations
+// field of a multipart upload request. Query is left out of persisted
+// queries known by their hash.
+type operations struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName"`
+	Variables     interface{}            `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
 }
 
-func (c *GraphqlClient) RawUpload(ctx context.Context, document string, operationName string, variables interface{}, headers *map[string]string, files []FileConfig) (*gjson.Result, *http.Header, error) {
+func newOperations(document string, operationName string, variables interface{}) *operations {
+	return &operations{
+		Query:         document,
+		OperationName: operationName,
+		Variables:     variables,
+	}
+}
+
+// newRequest creates a request carrying the client's default headers and
+// the headers of the call.
+func (c *GraphqlClient) newRequest(ctx context.Context, headers *map[string]string) *resty.Request {
 	request := c.Client.R()
 	if ctx != nil {
 		request.SetContext(ctx)
 	}
+	request.Header = c.header(headers)
+	return request
+}
+
+// header returns the client's default headers overridden by the headers of
+// the call, both may override the default Accept header.
+func (c *GraphqlClient) header(headers *map[string]string) http.Header {
+	header := make(http.Header)
+	header.Set("Accept", acceptHeader)
 	for k, v := range c.DefaultHeaders {
-		request.SetHeader(k, v)
+		header.Set(k, v)
 	}
 	if headers != nil {
 		for k, v := range *headers {
-			request.SetHeader(k, v)
+			header.Set(k, v)
 		}
 	}
-	// as httpclient use map[string][]string as formdata, which make formdata's order unreliable
-	// use mime package here to build raw body
-	var bBody bytes.Buffer
-	writer := multipart.NewWriter(&bBody)
-	mapping := make(map[string][]string)
-	for i, file := range files {
-		mapping[fmt.Sprintf("%d", i)] = []string{fmt.Sprintf("variables.%s", file.Path)}
-	}
-	bMapping, err := json.Marshal(mapping)
-	if err != nil {
-		return nil, nil, err
-	}
-	bVariables, err := json.Marshal(variables)
-	if err != nil {
-		return nil, nil, err
-	}
-	writer.WriteField("operations", fmt.Sprintf(`{"query": "%s", "operationName": "%s", "variables": %s}`, document, operationName, bVariables))
-	writer.WriteField("map", string(bMapping))
-	for i, file := range files {
-		part, err := writer.CreateFormFile(fmt.Sprintf("%d", i), "file")
-		if err != nil {
-			return nil, nil, err
-		}
-		part.Write(*file.Bytes)
-	}
-	writer.Close()
-	request.SetBody(bBody.Bytes())
-	request.SetHeader("Content-Type", writer.FormDataContentType())
+	return header
+}
 
-	resp, err := request.Post(c.Endpoint)
-	if err != nil {
-		return nil, nil, err
-	}
-	result := gjson.ParseBytes(resp.Body())
+// graphqlResponseMediaType is the media type of the graphql over http spec,
+// its responses carry request errors with a 4xx or 5xx status.
+const graphqlResponseMediaType = "application/graphql-response+json"
+
+// acceptHeader prefers the graphql over http media type but still accepts
+// plain json from servers which do not support it.
+const acceptHeader = graphqlResponseMediaType + ", application/json;q=0.9"
+
+// parseResponse extracts data and errors of a graphql response. When the
+// response has errors, a GraphQLErrors is returned together with the data
+// unless data is missing or null. A body that is not json or a non 2xx
+// status results in an HTTPError, except for plain json responses carrying
+// data, as servers predating application/graphql-response+json may use any
+// status for partial results.
+func parseResponse(resp *http.Response, body []byte) (*gjson.Result, *http.Header, error) {
+	respHeader := resp.Header
+	if !gjson.ValidBytes(body) {
+		return nil, &respHeader, newHTTPError(resp, body)
+	}
+	result := gjson.ParseBytes(body)
+	gqldata := result.Get("data")
 	gqlerror := result.Get("errors")
+	hasData := gqldata.Exists() && gqldata.Type != gjson.Null
+	legacy := !strings.HasPrefix(respHeader.Get("Content-Type"), graphqlResponseMediaType)
+	if !isSuccess(resp) && !(legacy && hasData) {
+		httpError := newHTTPError(resp, body)
+		if gqlerror.Exists() {
+			httpError.Errors = parseGraphQLErrors(gqlerror.Raw)
+		}
+		return nil, &respHeader, httpError
+	}
 	if gqlerror.Exists() {
-		return nil, nil, fmt.Errorf("%v", gqlerror)
+		errs := parseGraphQLErrors(gqlerror.Raw)
+		if !hasData {
+			return nil, &respHeader, errs
+		}
+		return &gqldata, &respHeader, errs
 	}
-	gqldata := result.Get("data")
 	if !gqldata.Exists() {
-		return nil, nil, fmt.Errorf("data not found")
+		return nil, &respHeader, fmt.Errorf("data not found")
 	}
-	respHeaders := resp.Header()
-	return &gqldata, &respHeaders, nil
+	return &gqldata, &respHeader, nil
 }
 
-func NewClient(endpoint string) (*GraphqlClient, error) {
-	introspection, err := getIntrospection(endpoint)
+func isSuccess(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// NewClient introspects the schema of endpoint and builds a client for it,
+// the options apply to the introspection query as well as to the client.
+func NewClient(endpoint string, opts ...Option) (*GraphqlClient, error) {
+	var options = newOptions(opts)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	introspection, err := getIntrospection(context.Background(), endpoint, options)
 	if err != nil {
 		return nil, err
 	}
-	client := introspection.ParseSchema()
-	return client, nil
+	return introspection.parseSchema(options)
 }
@@ -2,9 +2,15 @@ package dgql_test
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/Sczlog/dgql"
+	"github.com/graphql-go/graphql"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +47,469 @@ func TestMutation(t *testing.T) {
 	}
 	println(resp.Raw)
 }
+
+// newTestServer serves schema over http the way a typical graphql endpoint does.
+func newTestServer(t *testing.T, schema graphql.Schema) *httptest.Server {
+	server := httptest.NewServer(newTestHandler(schema))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestHandler(schema graphql.Schema) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var p struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result := graphql.Do(graphql.Params{
+			Context:        req.Context(),
+			Schema:         schema,
+			RequestString:  p.Query,
+			VariableValues: p.Variables,
+			OperationName:  p.OperationName,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+func TestCustomRootTypes(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "RootQuery",
+			Fields: graphql.Fields{
+				"hello": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return "world", nil
+					},
+				},
+			},
+		}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := newTestServer(t, schema)
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	resp, _, err := client.Query(context.Background(), "hello", nil, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "world", resp.Get("hello").String())
+	_, _, err = client.Mutation(context.Background(), "create", nil, nil)
+	assert.Error(t, err, "read-only schema should have no mutations")
+}
+
+func TestClientsOwnTheirSchema(t *testing.T) {
+	newProductSchema := func(field string, value interface{}) graphql.Schema {
+		product := graphql.NewObject(graphql.ObjectConfig{
+			Name: "Product",
+			Fields: graphql.Fields{
+				field: &graphql.Field{Type: graphql.String},
+			},
+		})
+		schema, _ := graphql.NewSchema(graphql.SchemaConfig{
+			Query: graphql.NewObject(graphql.ObjectConfig{
+				Name: "Query",
+				Fields: graphql.Fields{
+					"product": &graphql.Field{
+						Type: product,
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							return map[string]interface{}{field: value}, nil
+						},
+					},
+				},
+			}),
+		})
+		return schema
+	}
+	servers := map[string]*httptest.Server{
+		"name": newTestServer(t, newProductSchema("name", "dgql")),
+		"sku":  newTestServer(t, newProductSchema("sku", "A-1")),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for field, server := range servers {
+			wg.Add(1)
+			go func(field string, endpoint string) {
+				defer wg.Done()
+				client, err := dgql.NewClient(endpoint)
+				if !assert.NoError(t, err, "Error creating client") {
+					return
+				}
+				resp, _, err := client.Query(context.Background(), "product", nil, nil)
+				if !assert.NoError(t, err, "Error querying") {
+					return
+				}
+				assert.True(t, resp.Get("product."+field).Exists())
+			}(field, server.URL)
+		}
+	}
+	wg.Wait()
+}
+
+func TestTypeRefString(t *testing.T) {
+	intType := &dgql.TypeRef{Kind: "SCALAR", Name: "Int"}
+	nonNull := func(t *dgql.TypeRef) *dgql.TypeRef { return &dgql.TypeRef{Kind: "NON_NULL", OfType: t} }
+	list := func(t *dgql.TypeRef) *dgql.TypeRef { return &dgql.TypeRef{Kind: "LIST", OfType: t} }
+	assert.Equal(t, "Int", intType.String())
+	assert.Equal(t, "[Int]", list(intType).String())
+	assert.Equal(t, "[Int!]!", nonNull(list(nonNull(intType))).String())
+	assert.Equal(t, "[[Int!]]!", nonNull(list(list(nonNull(intType)))).String())
+	assert.Equal(t, intType, nonNull(list(list(nonNull(intType)))).Named())
+	assert.True(t, nonNull(list(intType)).IsList())
+}
+
+func TestListArguments(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"count": &graphql.Field{
+					Type: graphql.Int,
+					Args: graphql.FieldConfigArgument{
+						"ids": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID))),
+						},
+						"matrix": &graphql.ArgumentConfig{
+							Type: graphql.NewList(graphql.NewList(graphql.NewNonNull(graphql.Int))),
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						count := len(p.Args["ids"].([]interface{}))
+						if matrix, ok := p.Args["matrix"].([]interface{}); ok {
+							for _, row := range matrix {
+								count += len(row.([]interface{}))
+							}
+						}
+						return count, nil
+					},
+				},
+			},
+		}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := newTestServer(t, schema)
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	resp, _, err := client.Query(context.Background(), "count", map[string]interface{}{
+		"ids":    []string{"a", "b"},
+		"matrix": [][]int{{1, 2}, {3}},
+	}, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, int64(5), resp.Get("count").Int())
+}
+
+func newRecursiveSchema(t *testing.T) graphql.Schema {
+	var userType *graphql.Object
+	tagType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tag",
+		Fields: graphql.Fields{
+			"label": &graphql.Field{Type: graphql.String},
+		},
+	})
+	postType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"title":  &graphql.Field{Type: graphql.String},
+				"author": &graphql.Field{Type: userType},
+				"tags":   &graphql.Field{Type: graphql.NewList(tagType)},
+			}
+		}),
+	})
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name":    &graphql.Field{Type: graphql.String},
+				"friends": &graphql.Field{Type: graphql.NewList(userType)},
+				"posts":   &graphql.Field{Type: graphql.NewList(postType)},
+			}
+		}),
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"me": &graphql.Field{
+					Type: userType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return map[string]interface{}{
+							"name": "dgql",
+							"posts": []interface{}{
+								map[string]interface{}{
+									"title": "hello",
+									"tags":  []interface{}{map[string]interface{}{"label": "go"}},
+								},
+							},
+						}, nil
+					},
+				},
+			},
+		}),
+	})
+	assert.NoError(t, err)
+	return schema
+}
+
+func TestMaxDepth(t *testing.T) {
+	server := newTestServer(t, newRecursiveSchema(t))
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, truncated, err := client.Document(dgql.OperationQuery, "me")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "query me { me { name posts { title } } }", document)
+	assert.Equal(t, []string{"me.friends", "me.posts.author", "me.posts.tags"}, truncated)
+
+	document, truncated, err = client.Document(dgql.OperationQuery, "me", dgql.WithDepth(3))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "query me { me { name posts { tags { label } title } } }", document)
+	assert.Equal(t, []string{"me.friends", "me.posts.author"}, truncated)
+
+	resp, _, err := client.Query(context.Background(), "me", nil, nil, dgql.WithDepth(3))
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "go", resp.Get("me.posts.0.tags.0.label").String())
+
+	client, err = dgql.NewClient(server.URL, dgql.WithMaxDepth(1))
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, _, err = client.Document(dgql.OperationQuery, "me")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query me { me { name } }", document)
+	}
+	// a depth of zero keeps the one of the client
+	document, _, err = client.Document(dgql.OperationQuery, "me", dgql.WithDepth(0))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query me { me { name } }", document)
+	}
+
+	_, err = dgql.NewClient(server.URL, dgql.WithMaxDepth(-1))
+	assert.EqualError(t, err, "invalid max depth -1")
+}
+
+func TestFieldSelection(t *testing.T) {
+	server := newTestServer(t, newRecursiveSchema(t))
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, _, err := client.Document(dgql.OperationQuery, "me", dgql.WithFields("posts.tags.label"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query me { me { posts { tags { label } } } }", document)
+	}
+	document, _, err = client.Document(dgql.OperationQuery, "me", dgql.WithFields("name", "posts"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query me { me { name posts { title } } }", document)
+	}
+	document, _, err = client.Document(dgql.OperationQuery, "me", dgql.WithoutFields("posts"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query me { me { name } }", document)
+	}
+	_, _, err = client.Document(dgql.OperationQuery, "me", dgql.WithFields("email"))
+	assert.EqualError(t, err, "field me.email not found")
+	_, _, err = client.Document(dgql.OperationQuery, "me", dgql.WithFields("name.first"))
+	assert.EqualError(t, err, "field me.name has no subfields")
+	_, _, err = client.Document(dgql.OperationQuery, "me", dgql.WithoutFields("posts.body"))
+	assert.EqualError(t, err, "field me.posts.body not found")
+
+	resp, _, err := client.Query(context.Background(), "me", nil, nil, dgql.WithFields("posts.title"))
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, `{"me":{"posts":[{"title":"hello"}]}}`, resp.Raw)
+}
+
+func TestAbstractTypes(t *testing.T) {
+	nodeInterface := graphql.NewInterface(graphql.InterfaceConfig{
+		Name: "Node",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{Type: graphql.ID},
+		},
+	})
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:       "User",
+		Interfaces: []*graphql.Interface{nodeInterface},
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.ID},
+			"name": &graphql.Field{Type: graphql.String},
+		},
+		IsTypeOf: func(p graphql.IsTypeOfParams) bool {
+			_, ok := p.Value.(map[string]interface{})["name"]
+			return ok
+		},
+	})
+	postType := graphql.NewObject(graphql.ObjectConfig{
+		Name:       "Post",
+		Interfaces: []*graphql.Interface{nodeInterface},
+		Fields: graphql.Fields{
+			"id":    &graphql.Field{Type: graphql.ID},
+			"title": &graphql.Field{Type: graphql.String},
+		},
+		IsTypeOf: func(p graphql.IsTypeOfParams) bool {
+			_, ok := p.Value.(map[string]interface{})["title"]
+			return ok
+		},
+	})
+	searchResult := graphql.NewUnion(graphql.UnionConfig{
+		Name:  "SearchResult",
+		Types: []*graphql.Object{userType, postType},
+	})
+	data := []interface{}{
+		map[string]interface{}{"id": "1", "name": "dgql"},
+		map[string]interface{}{"id": "2", "title": "hello"},
+	}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"node": &graphql.Field{
+					Type: nodeInterface,
+					Args: graphql.FieldConfigArgument{
+						"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						for _, item := range data {
+							if item.(map[string]interface{})["id"] == p.Args["id"] {
+								return item, nil
+							}
+						}
+						return nil, nil
+					},
+				},
+				"search": &graphql.Field{
+					Type: graphql.NewList(searchResult),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return data, nil
+					},
+				},
+			},
+		}),
+		Types: []graphql.Type{userType, postType},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := newTestServer(t, schema)
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, _, err := client.Document(dgql.OperationQuery, "search")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query search { search { __typename ... on User { id name } ... on Post { id title } } }", document)
+	}
+	document, _, err = client.Document(dgql.OperationQuery, "search", dgql.WithFields("title"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query search { search { __typename ... on Post { title } } }", document)
+	}
+	resp, _, err := client.Query(context.Background(), "search", nil, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "hello", resp.Get("search.1.title").String())
+	resp, _, err = client.Query(context.Background(), "node", map[string]interface{}{"id": "1"}, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "User", resp.Get("node.__typename").String())
+	assert.Equal(t, "dgql", resp.Get("node.name").String())
+	// the fields of an interface are selected outside of the fragments
+	// the possible types of an interface come in no particular order
+	document, _, err = client.Document(dgql.OperationQuery, "node")
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(document, "query node($id: ID!) { node(id: $id) { __typename id ... on "), document)
+		assert.Contains(t, document, "... on Post { title }")
+		assert.Contains(t, document, "... on User { name }")
+	}
+	document, _, err = client.Document(dgql.OperationQuery, "node", dgql.WithFields("id", "name"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query node($id: ID!) { node(id: $id) { __typename id ... on User { name } } }", document)
+	}
+}
+
+func TestConflictingFragments(t *testing.T) {
+	aType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "A",
+		Fields: graphql.Fields{
+			"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"value": &graphql.Field{Type: graphql.String},
+		},
+		IsTypeOf: func(p graphql.IsTypeOfParams) bool {
+			_, ok := p.Value.(map[string]interface{})["value"].(string)
+			return ok
+		},
+	})
+	bType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "B",
+		Fields: graphql.Fields{
+			"id":    &graphql.Field{Type: graphql.ID},
+			"value": &graphql.Field{Type: graphql.Int},
+		},
+		IsTypeOf: func(p graphql.IsTypeOfParams) bool {
+			_, ok := p.Value.(map[string]interface{})["value"].(int)
+			return ok
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"search": &graphql.Field{
+					Type: graphql.NewList(graphql.NewUnion(graphql.UnionConfig{
+						Name:  "Result",
+						Types: []*graphql.Object{aType, bType},
+					})),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return []interface{}{
+							map[string]interface{}{"id": "1", "value": "one"},
+							map[string]interface{}{"id": "2", "value": 2},
+						}, nil
+					},
+				},
+			},
+		}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := newTestServer(t, schema)
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, _, err := client.Document(dgql.OperationQuery, "search")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query search { search { __typename ... on A { A_id: id A_value: value } ... on B { B_id: id B_value: value } } }", document)
+	}
+	resp, _, err := client.Query(context.Background(), "search", nil, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "one", resp.Get("search.0.A_value").String())
+	assert.Equal(t, int64(2), resp.Get("search.1.B_value").Int())
+}
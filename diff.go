@@ -0,0 +1,475 @@
+package dgql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Criticality tells how a schema change affects existing clients.
+type Criticality int
+
+const (
+	// Safe changes do not affect existing operations.
+	Safe Criticality = iota
+	// Dangerous changes keep existing operations valid but may change what
+	// they return, e.g. a new enum value a client does not handle.
+	Dangerous
+	// Breaking changes make existing operations invalid or change the shape
+	// of their results.
+	Breaking
+)
+
+func (c Criticality) String() string {
+	switch c {
+	case Safe:
+		return "safe"
+	case Dangerous:
+		return "dangerous"
+	case Breaking:
+		return "breaking"
+	}
+	return fmt.Sprintf("criticality(%d)", int(c))
+}
+
+func (c Criticality) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// ChangeKind identifies what kind of change was made to a schema.
+type ChangeKind string
+
+const (
+	RootTypeChanged                 ChangeKind = "ROOT_TYPE_CHANGED"
+	TypeAdded                       ChangeKind = "TYPE_ADDED"
+	TypeRemoved                     ChangeKind = "TYPE_REMOVED"
+	TypeKindChanged                 ChangeKind = "TYPE_KIND_CHANGED"
+	FieldAdded                      ChangeKind = "FIELD_ADDED"
+	FieldRemoved                    ChangeKind = "FIELD_REMOVED"
+	FieldTypeChanged                ChangeKind = "FIELD_TYPE_CHANGED"
+	FieldDeprecated                 ChangeKind = "FIELD_DEPRECATED"
+	ArgAdded                        ChangeKind = "ARG_ADDED"
+	ArgRemoved                      ChangeKind = "ARG_REMOVED"
+	ArgTypeChanged                  ChangeKind = "ARG_TYPE_CHANGED"
+	ArgDefaultValueChanged          ChangeKind = "ARG_DEFAULT_VALUE_CHANGED"
+	InputFieldAdded                 ChangeKind = "INPUT_FIELD_ADDED"
+	InputFieldRemoved               ChangeKind = "INPUT_FIELD_REMOVED"
+	InputFieldTypeChanged           ChangeKind = "INPUT_FIELD_TYPE_CHANGED"
+	InputFieldDefaultValueChanged   ChangeKind = "INPUT_FIELD_DEFAULT_VALUE_CHANGED"
+	EnumValueAdded                  ChangeKind = "ENUM_VALUE_ADDED"
+	EnumValueRemoved                ChangeKind = "ENUM_VALUE_REMOVED"
+	EnumValueDeprecated             ChangeKind = "ENUM_VALUE_DEPRECATED"
+	PossibleTypeAdded               ChangeKind = "POSSIBLE_TYPE_ADDED"
+	PossibleTypeRemoved             ChangeKind = "POSSIBLE_TYPE_REMOVED"
+	InterfaceAdded                  ChangeKind = "INTERFACE_ADDED"
+	InterfaceRemoved                ChangeKind = "INTERFACE_REMOVED"
+	DirectiveAdded                  ChangeKind = "DIRECTIVE_ADDED"
+	DirectiveRemoved                ChangeKind = "DIRECTIVE_REMOVED"
+	DirectiveLocationAdded          ChangeKind = "DIRECTIVE_LOCATION_ADDED"
+	DirectiveLocationRemoved        ChangeKind = "DIRECTIVE_LOCATION_REMOVED"
+	DirectiveArgAdded               ChangeKind = "DIRECTIVE_ARG_ADDED"
+	DirectiveArgRemoved             ChangeKind = "DIRECTIVE_ARG_REMOVED"
+	DirectiveArgTypeChanged         ChangeKind = "DIRECTIVE_ARG_TYPE_CHANGED"
+	DirectiveArgDefaultValueChanged ChangeKind = "DIRECTIVE_ARG_DEFAULT_VALUE_CHANGED"
+)
+
+// Change is a single difference between two schemas.
+type Change struct {
+	Kind        ChangeKind  `json:"kind"`
+	Criticality Criticality `json:"criticality"`
+	// Path is the schema coordinate of the changed element, e.g. User,
+	// User.friends, User.friends(first:) or @auth(role:).
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s", c.Criticality, c.Message)
+}
+
+// Changes lists the differences between two schemas, sorted by path.
+type Changes []Change
+
+// Breaking reports whether any of the changes is breaking.
+func (c Changes) Breaking() bool {
+	for _, change := range c {
+		if change.Criticality == Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// String prints one change per line.
+func (c Changes) String() string {
+	lines := make([]string, len(c))
+	for i, change := range c {
+		lines[i] = change.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffSchema compares the schemas of two introspection results and lists
+// the types, fields, arguments, enum values and directives that were added,
+// removed or changed in after, each classified by how it affects clients
+// written against before.
+func DiffSchema(before *Introspection, after *Introspection) Changes {
+	d := &schemaDiff{}
+	d.roots(before.Schema, after.Schema)
+	d.types(before.Schema.Types, after.Schema.Types)
+	d.directives(before.Schema.Directives, after.Schema.Directives)
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		return d.changes[i].Path < d.changes[j].Path
+	})
+	return d.changes
+}
+
+type schemaDiff struct {
+	changes Changes
+}
+
+func (d *schemaDiff) add(kind ChangeKind, criticality Criticality, path string, format string, args ...interface{}) {
+	d.changes = append(d.changes, Change{
+		Kind:        kind,
+		Criticality: criticality,
+		Path:        path,
+		Message:     fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *schemaDiff) roots(before *IntrospectionSchema, after *IntrospectionSchema) {
+	roots := []struct {
+		operation     string
+		before, after *IntrospectionRootType
+	}{
+		{OperationQuery, before.QueryType, after.QueryType},
+		{OperationMutation, before.MutationType, after.MutationType},
+		{OperationSubscription, before.SubscriptionType, after.SubscriptionType},
+	}
+	for _, root := range roots {
+		var beforeName, afterName string
+		if root.before != nil {
+			beforeName = root.before.Name
+		}
+		if root.after != nil {
+			afterName = root.after.Name
+		}
+		if beforeName == afterName {
+			continue
+		}
+		criticality := Breaking
+		if beforeName == "" {
+			criticality = Safe
+		}
+		d.add(RootTypeChanged, criticality, root.operation, "%s root type changed from %q to %q", root.operation, beforeName, afterName)
+	}
+}
+
+func (d *schemaDiff) types(before []*IntrospectionType, after []*IntrospectionType) {
+	afterTypes := make(map[string]*IntrospectionType, len(after))
+	for _, t := range after {
+		afterTypes[t.Name] = t
+	}
+	beforeTypes := make(map[string]*IntrospectionType, len(before))
+	for _, t := range before {
+		if strings.HasPrefix(t.Name, "__") {
+			continue
+		}
+		beforeTypes[t.Name] = t
+		afterType, ok := afterTypes[t.Name]
+		if !ok {
+			d.add(TypeRemoved, Breaking, t.Name, "type %s was removed", t.Name)
+			continue
+		}
+		if t.Kind != afterType.Kind {
+			d.add(TypeKindChanged, Breaking, t.Name, "type %s changed from %s to %s", t.Name, t.Kind, afterType.Kind)
+			continue
+		}
+		switch t.Kind {
+		case "OBJECT":
+			d.fields(t, afterType)
+			d.interfaces(t, afterType)
+		case "INTERFACE":
+			d.fields(t, afterType)
+			d.interfaces(t, afterType)
+			d.possibleTypes(t, afterType)
+		case "UNION":
+			d.possibleTypes(t, afterType)
+		case "ENUM":
+			d.enumValues(t, afterType)
+		case "INPUT_OBJECT":
+			d.inputFields(t, afterType)
+		}
+	}
+	for _, t := range after {
+		if _, ok := beforeTypes[t.Name]; !ok && !strings.HasPrefix(t.Name, "__") {
+			d.add(TypeAdded, Safe, t.Name, "type %s was added", t.Name)
+		}
+	}
+}
+
+func (d *schemaDiff) fields(before *IntrospectionType, after *IntrospectionType) {
+	afterFields := make(map[string]*IntrospectionField, len(after.Fields))
+	for _, field := range after.Fields {
+		afterFields[field.Name] = field
+	}
+	beforeFields := make(map[string]bool, len(before.Fields))
+	for _, field := range before.Fields {
+		beforeFields[field.Name] = true
+		path := before.Name + "." + field.Name
+		afterField, ok := afterFields[field.Name]
+		if !ok {
+			d.add(FieldRemoved, Breaking, path, "field %s was removed", path)
+			continue
+		}
+		beforeType, afterType := field.Type.typeRef(), afterField.Type.typeRef()
+		if beforeType.String() != afterType.String() {
+			criticality := Breaking
+			if safeOutputChange(beforeType, afterType) {
+				criticality = Safe
+			}
+			d.add(FieldTypeChanged, criticality, path, "field %s changed type from %s to %s", path, beforeType, afterType)
+		}
+		if !field.IsDeprecated && afterField.IsDeprecated {
+			d.add(FieldDeprecated, Dangerous, path, "field %s was deprecated", path)
+		}
+		d.args(path, field.Args, afterField.Args)
+	}
+	for _, field := range after.Fields {
+		if !beforeFields[field.Name] {
+			path := before.Name + "." + field.Name
+			d.add(FieldAdded, Safe, path, "field %s was added", path)
+		}
+	}
+}
+
+func (d *schemaDiff) args(fieldPath string, before []*IntrospectionInputValue, after []*IntrospectionInputValue) {
+	d.inputValues(before, after, inputValueKinds{
+		added:          ArgAdded,
+		removed:        ArgRemoved,
+		typeChanged:    ArgTypeChanged,
+		defaultChanged: ArgDefaultValueChanged,
+		noun:           "argument",
+		path: func(name string) string {
+			return fmt.Sprintf("%s(%s:)", fieldPath, name)
+		},
+	})
+}
+
+func (d *schemaDiff) inputFields(before *IntrospectionType, after *IntrospectionType) {
+	d.inputValues(before.InputFields, after.InputFields, inputValueKinds{
+		added:          InputFieldAdded,
+		removed:        InputFieldRemoved,
+		typeChanged:    InputFieldTypeChanged,
+		defaultChanged: InputFieldDefaultValueChanged,
+		noun:           "input field",
+		path: func(name string) string {
+			return before.Name + "." + name
+		},
+	})
+}
+
+// inputValueKinds tells inputValues which kind of input values it compares.
+type inputValueKinds struct {
+	added, removed, typeChanged, defaultChanged ChangeKind
+	noun                                        string
+	path                                        func(name string) string
+}
+
+// inputValues compares arguments or input fields, which are breaking when
+// added as required, removed or changed to a type existing values may not
+// satisfy.
+func (d *schemaDiff) inputValues(before []*IntrospectionInputValue, after []*IntrospectionInputValue, kinds inputValueKinds) {
+	afterValues := make(map[string]*IntrospectionInputValue, len(after))
+	for _, value := range after {
+		afterValues[value.Name] = value
+	}
+	beforeValues := make(map[string]bool, len(before))
+	for _, value := range before {
+		beforeValues[value.Name] = true
+		path := kinds.path(value.Name)
+		afterValue, ok := afterValues[value.Name]
+		if !ok {
+			d.add(kinds.removed, Breaking, path, "%s %s was removed", kinds.noun, path)
+			continue
+		}
+		beforeType, afterType := value.Type.typeRef(), afterValue.Type.typeRef()
+		if beforeType.String() != afterType.String() {
+			criticality := Breaking
+			if safeInputChange(beforeType, afterType) {
+				criticality = Safe
+			}
+			d.add(kinds.typeChanged, criticality, path, "%s %s changed type from %s to %s", kinds.noun, path, beforeType, afterType)
+		}
+		if value.DefaultValue != afterValue.DefaultValue {
+			d.add(kinds.defaultChanged, Dangerous, path, "%s %s changed default value from %q to %q", kinds.noun, path, value.DefaultValue, afterValue.DefaultValue)
+		}
+	}
+	for _, value := range after {
+		if beforeValues[value.Name] {
+			continue
+		}
+		path := kinds.path(value.Name)
+		if value.Type.Kind == "NON_NULL" && value.DefaultValue == "" {
+			d.add(kinds.added, Breaking, path, "required %s %s was added", kinds.noun, path)
+		} else {
+			d.add(kinds.added, Dangerous, path, "optional %s %s was added", kinds.noun, path)
+		}
+	}
+}
+
+func (d *schemaDiff) interfaces(before *IntrospectionType, after *IntrospectionType) {
+	removed, added := diffNames(typeRefNames(before.Interfaces), typeRefNames(after.Interfaces))
+	for _, name := range removed {
+		d.add(InterfaceRemoved, Breaking, before.Name, "%s no longer implements %s", before.Name, name)
+	}
+	for _, name := range added {
+		d.add(InterfaceAdded, Dangerous, before.Name, "%s now implements %s", before.Name, name)
+	}
+}
+
+// possibleTypes reports the members of a union and the implementations of an
+// interface that changed, as they decide which inline fragments match.
+func (d *schemaDiff) possibleTypes(before *IntrospectionType, after *IntrospectionType) {
+	removed, added := diffNames(typeRefNames(before.PossibleTypes), typeRefNames(after.PossibleTypes))
+	for _, name := range removed {
+		d.add(PossibleTypeRemoved, Breaking, before.Name, "%s is no longer a possible type of %s", name, before.Name)
+	}
+	for _, name := range added {
+		d.add(PossibleTypeAdded, Dangerous, before.Name, "%s is now a possible type of %s", name, before.Name)
+	}
+}
+
+func (d *schemaDiff) enumValues(before *IntrospectionType, after *IntrospectionType) {
+	afterValues := make(map[string]*IntrospectionEnumValue, len(after.EnumValues))
+	for _, value := range after.EnumValues {
+		afterValues[value.Name] = value
+	}
+	beforeValues := make(map[string]bool, len(before.EnumValues))
+	for _, value := range before.EnumValues {
+		beforeValues[value.Name] = true
+		path := before.Name + "." + value.Name
+		afterValue, ok := afterValues[value.Name]
+		if !ok {
+			d.add(EnumValueRemoved, Breaking, path, "enum value %s was removed", path)
+			continue
+		}
+		if !value.IsDeprecated && afterValue.IsDeprecated {
+			d.add(EnumValueDeprecated, Dangerous, path, "enum value %s was deprecated", path)
+		}
+	}
+	for _, value := range after.EnumValues {
+		if !beforeValues[value.Name] {
+			path := before.Name + "." + value.Name
+			d.add(EnumValueAdded, Dangerous, path, "enum value %s was added", path)
+		}
+	}
+}
+
+func (d *schemaDiff) directives(before []*IntrospectionDirective, after []*IntrospectionDirective) {
+	afterDirectives := make(map[string]*IntrospectionDirective, len(after))
+	for _, directive := range after {
+		afterDirectives[directive.Name] = directive
+	}
+	beforeDirectives := make(map[string]bool, len(before))
+	for _, directive := range before {
+		beforeDirectives[directive.Name] = true
+		path := "@" + directive.Name
+		afterDirective, ok := afterDirectives[directive.Name]
+		if !ok {
+			d.add(DirectiveRemoved, Breaking, path, "directive %s was removed", path)
+			continue
+		}
+		removed, added := diffNames(directive.Locations, afterDirective.Locations)
+		for _, location := range removed {
+			d.add(DirectiveLocationRemoved, Breaking, path, "location %s was removed from directive %s", location, path)
+		}
+		for _, location := range added {
+			d.add(DirectiveLocationAdded, Safe, path, "location %s was added to directive %s", location, path)
+		}
+		d.inputValues(directive.Args, afterDirective.Args, inputValueKinds{
+			added:          DirectiveArgAdded,
+			removed:        DirectiveArgRemoved,
+			typeChanged:    DirectiveArgTypeChanged,
+			defaultChanged: DirectiveArgDefaultValueChanged,
+			noun:           "argument",
+			path: func(name string) string {
+				return fmt.Sprintf("%s(%s:)", path, name)
+			},
+		})
+	}
+	for _, directive := range after {
+		if !beforeDirectives[directive.Name] {
+			path := "@" + directive.Name
+			d.add(DirectiveAdded, Safe, path, "directive %s was added", path)
+		}
+	}
+}
+
+// safeOutputChange reports whether every value of the after type is a valid
+// value of the before type, e.g. String to String!. Types cut off by the
+// introspection are never safe.
+func safeOutputChange(before *TypeRef, after *TypeRef) bool {
+	if before == nil || after == nil {
+		return false
+	}
+	switch before.Kind {
+	case "LIST":
+		if after.Kind == "LIST" {
+			return safeOutputChange(before.OfType, after.OfType)
+		}
+	case "NON_NULL":
+		if after.Kind == "NON_NULL" {
+			return safeOutputChange(before.OfType, after.OfType)
+		}
+		return false
+	default:
+		if after.Kind != "LIST" && after.Kind != "NON_NULL" {
+			return before.Name == after.Name
+		}
+	}
+	return after.Kind == "NON_NULL" && safeOutputChange(before, after.OfType)
+}
+
+// safeInputChange reports whether every value accepted by the before type is
+// accepted by the after type, e.g. Int! to Int.
+func safeInputChange(before *TypeRef, after *TypeRef) bool {
+	if before == nil || after == nil {
+		return false
+	}
+	switch before.Kind {
+	case "LIST":
+		return after.Kind == "LIST" && safeInputChange(before.OfType, after.OfType)
+	case "NON_NULL":
+		if after.Kind == "NON_NULL" {
+			return safeInputChange(before.OfType, after.OfType)
+		}
+		return safeInputChange(before.OfType, after)
+	}
+	return after.Kind == before.Kind && after.Name == before.Name
+}
+
+func typeRefNames(refs []*IntrospectionTypeRef) []string {
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.Name
+	}
+	return names
+}
+
+// diffNames returns the names only in before and the ones only in after.
+func diffNames(before []string, after []string) ([]string, []string) {
+	removed := make([]string, 0)
+	for _, name := range before {
+		if !contains(after, name) {
+			removed = append(removed, name)
+		}
+	}
+	added := make([]string, 0)
+	for _, name := range after {
+		if !contains(before, name) {
+			added = append(added, name)
+		}
+	}
+	return removed, added
+}
@@ -0,0 +1,80 @@
+package dgql_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSchema(t *testing.T) {
+	before, err := dgql.ParseSDL(`
+type Query {
+  user(id: ID!, locale: String): User
+  users(ids: [ID!]!): [User]
+  search: Result
+}
+type User {
+  name: String!
+  email: String
+  age: Int
+  role: Role
+}
+type Admin implements Node { name: String }
+interface Node { name: String }
+union Result = User | Admin
+enum Role { ADMIN MEMBER }
+input Filter { name: String }
+`)
+	if !assert.NoError(t, err, "Error parsing schema") {
+		return
+	}
+	after, err := dgql.ParseSDL(`
+type Query {
+  user(id: ID, first: Int!): User
+  users(ids: [ID!]!, limit: Int = 10): [User]
+  search: Result
+}
+type User {
+  name: String
+  email: String!
+  role: Role @deprecated
+  avatar: String
+}
+type Guest implements Node { name: String }
+interface Node { name: String }
+union Result = User | Guest
+enum Role { MEMBER GUEST }
+input Filter { name: String age: Int! }
+`)
+	if !assert.NoError(t, err, "Error parsing schema") {
+		return
+	}
+	changes := dgql.DiffSchema(&dgql.Introspection{Schema: before}, &dgql.Introspection{Schema: after})
+	assert.True(t, changes.Breaking())
+	assert.Equal(t, `breaking: type Admin was removed
+breaking: required input field Filter.age was added
+safe: type Guest was added
+breaking: Admin is no longer a possible type of Node
+dangerous: Guest is now a possible type of Node
+breaking: required argument Query.user(first:) was added
+safe: argument Query.user(id:) changed type from ID! to ID
+breaking: argument Query.user(locale:) was removed
+dangerous: optional argument Query.users(limit:) was added
+breaking: Admin is no longer a possible type of Result
+dangerous: Guest is now a possible type of Result
+breaking: enum value Role.ADMIN was removed
+dangerous: enum value Role.GUEST was added
+breaking: field User.age was removed
+safe: field User.avatar was added
+safe: field User.email changed type from String to String!
+breaking: field User.name changed type from String! to String
+dangerous: field User.role was deprecated`, changes.String())
+
+	b, err := json.Marshal(changes[0])
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"kind":"TYPE_REMOVED","criticality":"breaking","path":"Admin","message":"type Admin was removed"}`, string(b))
+	}
+	assert.Empty(t, dgql.DiffSchema(&dgql.Introspection{Schema: before}, &dgql.Introspection{Schema: before}))
+}
@@ -0,0 +1,112 @@
+package dgql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GraphQLErrorLocation points at the part of the document an error refers to.
+type GraphQLErrorLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is a single entry of the errors array of a graphql response.
+type GraphQLError struct {
+	Message   string                 `json:"message"`
+	Locations []GraphQLErrorLocation `json:"locations,omitempty"`
+	// Path holds the field names and list indices leading to the failed
+	// field, as strings and float64s.
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprintf("%v", p)
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(path, "."), e.Message)
+}
+
+// GraphQLErrors is returned when a response contains errors. The data of
+// the response, if any, is returned alongside, so callers can use errors.As
+// to decide whether partial data is good enough.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("graphql: %s", strings.Join(messages, "; "))
+}
+
+func parseGraphQLErrors(raw string) GraphQLErrors {
+	var errs GraphQLErrors
+	if err := json.Unmarshal([]byte(raw), &errs); err != nil || len(errs) == 0 {
+		// not following the spec, keep the raw errors as message
+		return GraphQLErrors{{Message: raw}}
+	}
+	return errs
+}
+
+// maxErrorBody is how much of a response body HTTPError keeps.
+const maxErrorBody = 1024
+
+// HTTPError is returned when the server answers with a non 2xx status or with
+// a body that is not json, e.g. an html error page of a proxy. When the body
+// is a graphql response its errors are available through errors.As.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body is the response body truncated to 1KB.
+	Body   string
+	Errors GraphQLErrors
+}
+
+func (e *HTTPError) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("http %s: %s", e.Status, e.Errors.Error())
+	}
+	return fmt.Sprintf("http %s: %s", e.Status, e.Body)
+}
+
+func (e *HTTPError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors
+}
+
+func newHTTPError(resp *http.Response, body []byte) *HTTPError {
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody]
+	}
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       string(body),
+	}
+}
+
+// TransportError is returned when no response was received at all, e.g. the
+// connection was refused or the context was cancelled.
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("transport: %s", e.Err.Error())
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,139 @@
+package dgql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialData(t *testing.T) {
+	productType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Product",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.String},
+			"stock": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return nil, errors.New("inventory unavailable")
+				},
+			},
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"product": &graphql.Field{
+					Type: productType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return map[string]interface{}{"name": "dgql"}, nil
+					},
+				},
+			},
+		}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := newTestServer(t, schema)
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	resp, _, err := client.Query(context.Background(), "product", nil, nil)
+	var gqlErrors dgql.GraphQLErrors
+	if !assert.True(t, errors.As(err, &gqlErrors), "Expected graphql errors") {
+		return
+	}
+	assert.Len(t, gqlErrors, 1)
+	assert.Equal(t, "inventory unavailable", gqlErrors[0].Message)
+	assert.Equal(t, []interface{}{"product", "stock"}, gqlErrors[0].Path)
+	assert.NotEmpty(t, gqlErrors[0].Locations)
+	assert.Equal(t, "graphql: product.stock: inventory unavailable", err.Error())
+	if assert.NotNil(t, resp, "Partial data should be returned") {
+		assert.Equal(t, "dgql", resp.Get("product.name").String())
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	type cannedResponse struct {
+		status      int
+		contentType string
+		body        string
+	}
+	var canned *cannedResponse
+	var accept string
+	schema, _ := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"hello": &graphql.Field{Type: graphql.String},
+			},
+		}),
+	})
+	graphqlHandler := newTestHandler(schema)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		accept = req.Header.Get("Accept")
+		if canned == nil {
+			graphqlHandler.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", canned.contentType)
+		w.WriteHeader(canned.status)
+		w.Write([]byte(canned.body))
+	}))
+	defer server.Close()
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+
+	_, _, err = client.Query(context.Background(), "hello", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/graphql-response+json, application/json;q=0.9", accept)
+	// callers may still ask for a media type of their own
+	_, _, err = client.Query(context.Background(), "hello", nil, &map[string]string{"Accept": "application/json"})
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", accept)
+
+	canned = &cannedResponse{http.StatusBadGateway, "text/html", "<html>bad gateway</html>"}
+	_, _, err = client.Query(context.Background(), "hello", nil, nil)
+	var httpError *dgql.HTTPError
+	if assert.True(t, errors.As(err, &httpError), "Expected http error") {
+		assert.Equal(t, http.StatusBadGateway, httpError.StatusCode)
+		assert.Equal(t, "<html>bad gateway</html>", httpError.Body)
+	}
+
+	canned = &cannedResponse{http.StatusUnauthorized, "application/json", `{"errors":[{"message":"unauthorized"}]}`}
+	_, _, err = client.Query(context.Background(), "hello", nil, nil)
+	var gqlErrors dgql.GraphQLErrors
+	if assert.True(t, errors.As(err, &httpError), "Expected http error") {
+		assert.Equal(t, http.StatusUnauthorized, httpError.StatusCode)
+		assert.True(t, errors.As(err, &gqlErrors))
+	}
+
+	canned = &cannedResponse{http.StatusBadRequest, "application/graphql-response+json", `{"errors":[{"message":"syntax error"}]}`}
+	_, _, err = client.Query(context.Background(), "hello", nil, nil)
+	if assert.True(t, errors.As(err, &httpError), "Expected http error") {
+		assert.Equal(t, "syntax error", httpError.Errors[0].Message)
+	}
+
+	// plain json servers may report partial results with any status
+	canned = &cannedResponse{http.StatusInternalServerError, "application/json", `{"data":{"hello":"world"},"errors":[{"message":"boom"}]}`}
+	resp, _, err := client.Query(context.Background(), "hello", nil, nil)
+	assert.False(t, errors.As(err, &httpError))
+	if assert.True(t, errors.As(err, &gqlErrors)) && assert.NotNil(t, resp) {
+		assert.Equal(t, "world", resp.Get("hello").String())
+	}
+
+	server.Close()
+	_, _, err = client.Query(context.Background(), "hello", nil, nil)
+	var transportError *dgql.TransportError
+	assert.True(t, errors.As(err, &transportError), "Expected transport error")
+}
@@ -0,0 +1,139 @@
+package dgql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/tidwall/gjson"
+)
+
+// DefaultMaxURLLength is the longest url WithGetQueries sends a query with
+// unless told otherwise, a limit most servers, proxies and CDNs accept.
+const DefaultMaxURLLength = 2048
+
+// send sends an operation, as a persisted query when the client was created
+// WithPersistedQueries.
+func (c *GraphqlClient) send(ctx context.Context, operation string, document string, operationName string, variables interface{}, headers *map[string]string) (*gjson.Result, *http.Header, error) {
+	if c.persisted != nil && !c.persisted.unsupported.Load() {
+		return c.sendPersisted(ctx, operation, document, operationName, variables, headers)
+	}
+	return c.sendOperations(ctx, operation, newOperations(document, operationName, variables), headers)
+}
+
+// sendOperations posts an operation, or gets it when it is a query and the
+// client was created WithGetQueries.
+func (c *GraphqlClient) sendOperations(ctx context.Context, operation string, body *operations, headers *map[string]string) (*gjson.Result, *http.Header, error) {
+	if operation == OperationQuery && c.getQueries {
+		target, err := c.getURL(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		if target != "" {
+			return c.get(ctx, target, headers)
+		}
+	}
+	resp, err := c.newRequest(ctx, headers).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(c.Endpoint)
+	if err != nil {
+		return nil, nil, &TransportError{Err: err}
+	}
+	return parseResponse(resp.RawResponse, resp.Body())
+}
+
+// getURL returns the url a query is sent to as a GET request, with query,
+// operationName, variables and extensions as url parameters. It is empty when
+// the url would be longer than the limit of the client.
+func (c *GraphqlClient) getURL(body *operations) (string, error) {
+	target, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	params := target.Query()
+	if body.Query != "" {
+		params.Set("query", body.Query)
+	}
+	if body.OperationName != "" {
+		params.Set("operationName", body.OperationName)
+	}
+	if body.Variables != nil {
+		variables, err := json.Marshal(body.Variables)
+		if err != nil {
+			return "", err
+		}
+		if string(variables) != "null" {
+			params.Set("variables", string(variables))
+		}
+	}
+	if body.Extensions != nil {
+		extensions, err := json.Marshal(body.Extensions)
+		if err != nil {
+			return "", err
+		}
+		params.Set("extensions", string(extensions))
+	}
+	target.RawQuery = params.Encode()
+	result := target.String()
+	if len(result) > c.maxURLLength {
+		return "", nil
+	}
+	return result, nil
+}
+
+// get sends a query as a GET request, answering it from the cache of the
+// client while the cached response is fresh and revalidating it by its ETag
+// once it is stale.
+func (c *GraphqlClient) get(ctx context.Context, target string, headers *map[string]string) (*gjson.Result, *http.Header, error) {
+	request := c.newRequest(ctx, headers)
+	key := cacheKey(target, request.Header)
+	cached := c.cache.get(key)
+	if cached != nil {
+		if cached.fresh() {
+			return parseResponse(cached.response(), cached.body)
+		}
+		if cached.etag != "" {
+			request.SetHeader("If-None-Match", cached.etag)
+		}
+	}
+	resp, err := request.Get(target)
+	if err != nil {
+		return nil, nil, &TransportError{Err: err}
+	}
+	if resp.StatusCode() == http.StatusNotModified && cached != nil {
+		cached = c.cache.revalidate(key, cached, resp.RawResponse)
+		return parseResponse(cached.response(), cached.body)
+	}
+	c.cache.put(key, resp.RawResponse, resp.Body())
+	return parseResponse(resp.RawResponse, resp.Body())
+}
+
+// operationType returns the type of the operation named operationName in
+// document, or of its only operation when operationName is empty. It is
+// empty when the document can not be parsed or has no such operation.
+func operationType(document string, operationName string) string {
+	parsed, err := parser.Parse(parser.ParseParams{Source: document})
+	if err != nil {
+		return ""
+	}
+	var result string
+	count := 0
+	for _, definition := range parsed.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		count++
+		if operationName == "" || (operation.Name != nil && operation.Name.Value == operationName) {
+			result = operation.Operation
+		}
+	}
+	if operationName == "" && count != 1 {
+		return ""
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+package dgql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/stretchr/testify/assert"
+)
+
+const getSchema = `
+	type Query { user(id: ID!): String }
+	type Mutation { rename(name: String!): String }
+`
+
+// getRequest is a request received by newCachingServer.
+type getRequest struct {
+	Method      string
+	ID          string
+	IfNoneMatch string
+}
+
+// newCachingServer answers queries with the id they were called with. Ids
+// starting with "fresh" are cacheable for a minute, ids starting with "etag"
+// have to be revalidated with their ETag every time.
+func newCachingServer(t *testing.T) (*httptest.Server, func() []getRequest) {
+	var mu sync.Mutex
+	var requests []getRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if req.Method == http.MethodGet {
+			body.Query = req.URL.Query().Get("query")
+			json.Unmarshal([]byte(req.URL.Query().Get("variables")), &body.Variables)
+		} else {
+			json.NewDecoder(req.Body).Decode(&body)
+		}
+		id, _ := body.Variables["id"].(string)
+		if name, ok := body.Variables["name"].(string); ok {
+			id = name
+		}
+		mu.Lock()
+		requests = append(requests, getRequest{Method: req.Method, ID: id, IfNoneMatch: req.Header.Get("If-None-Match")})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(id, "fresh"):
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case strings.HasPrefix(id, "etag"):
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if req.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		field := "user"
+		if strings.HasPrefix(strings.TrimSpace(body.Query), "mutation") {
+			field = "rename"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{field: id}})
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []getRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		result := requests
+		requests = nil
+		return result
+	}
+}
+
+func TestGetQueries(t *testing.T) {
+	server, received := newCachingServer(t)
+	client, err := dgql.NewClientFromSDL(server.URL, getSchema, dgql.WithGetQueries(0))
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	resp, _, err := client.Query(context.Background(), "user", map[string]interface{}{"id": "fresh"}, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "fresh", resp.Get("user").String())
+	_, _, err = client.Mutation(context.Background(), "rename", map[string]interface{}{"name": "new"}, nil)
+	assert.NoError(t, err, "Error mutating")
+	// a query too long for a url is posted
+	long := strings.Repeat("x", dgql.DefaultMaxURLLength)
+	resp, _, err = client.Query(context.Background(), "user", map[string]interface{}{"id": long}, nil)
+	if assert.NoError(t, err, "Error querying") {
+		assert.Equal(t, long, resp.Get("user").String())
+	}
+	// raw documents are parsed for their operation type
+	_, _, err = client.Raw(context.Background(), `query raw($id: ID!) { user(id: $id) }`, "raw", map[string]interface{}{"id": "raw"}, nil)
+	assert.NoError(t, err, "Error querying")
+	_, _, err = client.Raw(context.Background(), `mutation raw($name: String!) { rename(name: $name) }`, "raw", map[string]interface{}{"name": "raw"}, nil)
+	assert.NoError(t, err, "Error mutating")
+	assert.Equal(t, []getRequest{
+		{Method: http.MethodGet, ID: "fresh"},
+		{Method: http.MethodPost, ID: "new"},
+		{Method: http.MethodPost, ID: long},
+		{Method: http.MethodGet, ID: "raw"},
+		{Method: http.MethodPost, ID: "raw"},
+	}, received())
+}
+
+func TestHTTPCache(t *testing.T) {
+	server, received := newCachingServer(t)
+	client, err := dgql.NewClientFromSDL(server.URL, getSchema, dgql.WithGetQueries(0), dgql.WithHTTPCache(10))
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	query := func(id string, headers *map[string]string) {
+		resp, _, err := client.Query(context.Background(), "user", map[string]interface{}{"id": id}, headers)
+		if assert.NoError(t, err, "Error querying") {
+			assert.Equal(t, id, resp.Get("user").String())
+		}
+	}
+	query("fresh", nil)
+	query("fresh", nil)
+	// responses are cached per headers
+	query("fresh", &map[string]string{"Authorization": "Bearer other"})
+	query("etag", nil)
+	query("etag", nil)
+	query("none", nil)
+	query("none", nil)
+	assert.Equal(t, []getRequest{
+		{Method: http.MethodGet, ID: "fresh"},
+		{Method: http.MethodGet, ID: "fresh"},
+		{Method: http.MethodGet, ID: "etag"},
+		{Method: http.MethodGet, ID: "etag", IfNoneMatch: `"v1"`},
+		{Method: http.MethodGet, ID: "none"},
+		{Method: http.MethodGet, ID: "none"},
+	}, received())
+}
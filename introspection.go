@@ -1,24 +1,116 @@
 package dgql
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/tidwall/gjson"
 )
 
-// introspection query
-var introspectionQuery = `
+// introspectionFeaturesQuery asks which optional fields the introspection
+// types of a server have, they were added by later versions of the spec.
+var introspectionFeaturesQuery = `
+  query IntrospectionFeatures {
+    schema: __type(name: "__Schema") { fields { name } }
+    type: __type(name: "__Type") { fields { name args { name } } }
+    field: __type(name: "__Field") { fields { name args { name } } }
+    directive: __type(name: "__Directive") { fields { name args { name } } }
+    inputValue: __type(name: "__InputValue") { fields { name } }
+  }
+`
+
+// introspectionFeatures are the optional parts of the introspection schema
+// supported by a server. The zero value only asks for what every server
+// supports.
+type introspectionFeatures struct {
+	// schemaDescription is __Schema.description
+	schemaDescription bool
+	// specifiedByURL is the name of __Type.specifiedByURL, which was
+	// specifiedByUrl in drafts of the spec, empty when not supported
+	specifiedByURL string
+	// oneOf is __Type.isOneOf
+	oneOf bool
+	// repeatable is __Directive.isRepeatable
+	repeatable bool
+	// inputValueDeprecation is __InputValue.isDeprecated together with the
+	// includeDeprecated argument of args and inputFields
+	inputValueDeprecation bool
+}
+
+// parseIntrospectionFeatures reads the response to introspectionFeaturesQuery.
+func parseIntrospectionFeatures(data gjson.Result) introspectionFeatures {
+	has := func(typeName string, field string) bool {
+		return data.Get(fmt.Sprintf(`%s.fields.#(name==%q)`, typeName, field)).Exists()
+	}
+	hasArg := func(typeName string, field string, arg string) bool {
+		return data.Get(fmt.Sprintf(`%s.fields.#(name==%q).args.#(name==%q)`, typeName, field, arg)).Exists()
+	}
+	var features introspectionFeatures
+	features.schemaDescription = has("schema", "description")
+	if has("type", "specifiedByURL") {
+		features.specifiedByURL = "specifiedByURL"
+	} else if has("type", "specifiedByUrl") {
+		features.specifiedByURL = "specifiedByUrl"
+	}
+	features.oneOf = has("type", "isOneOf")
+	features.repeatable = has("directive", "isRepeatable")
+	features.inputValueDeprecation = has("inputValue", "isDeprecated") &&
+		hasArg("type", "inputFields", "includeDeprecated") &&
+		hasArg("field", "args", "includeDeprecated") &&
+		hasArg("directive", "args", "includeDeprecated")
+	return features
+}
+
+// includeDeprecated returns the argument asking for deprecated arguments and
+// input fields when they are supported.
+func (f introspectionFeatures) includeDeprecated() string {
+	if f.inputValueDeprecation {
+		return "(includeDeprecated: true)"
+	}
+	return ""
+}
+
+// query builds the introspection query asking for the supported features.
+func (f introspectionFeatures) query() string {
+	var schemaFields, typeFields, directiveFields, inputValueFields string
+	includeDeprecated := f.includeDeprecated()
+	if f.schemaDescription {
+		schemaFields = "\n      description"
+	}
+	switch f.specifiedByURL {
+	case "specifiedByURL":
+		typeFields += "\n    specifiedByURL"
+	case "specifiedByUrl":
+		typeFields += "\n    specifiedByURL: specifiedByUrl"
+	}
+	if f.oneOf {
+		typeFields += "\n    isOneOf"
+	}
+	if f.repeatable {
+		directiveFields = "\n        isRepeatable"
+	}
+	if f.inputValueDeprecation {
+		inputValueFields = "\n    isDeprecated\n    deprecationReason"
+	}
+	return fmt.Sprintf(`
   query IntrospectionQuery {
-    __schema {
+    __schema {%s
+      queryType { name }
+      mutationType { name }
+      subscriptionType { name }
       types {
         ...FullType
       }
       directives {
         name
         description
-		    locations
-        args {
+        locations%s
+        args%s {
           ...InputValue
         }
       }
@@ -28,11 +120,11 @@ var introspectionQuery = `
   fragment FullType on __Type {
     kind
     name
-    description
+    description%s
     fields(includeDeprecated: true) {
       name
       description
-      args {
+      args%s {
         ...InputValue
       }
       type {
@@ -41,7 +133,7 @@ var introspectionQuery = `
       isDeprecated
       deprecationReason
     }
-    inputFields {
+    inputFields%s {
       ...InputValue
     }
     interfaces {
@@ -62,42 +154,30 @@ var introspectionQuery = `
     name
     description
     type { ...TypeRef }
-    defaultValue
+    defaultValue%s
   }
 
-  fragment TypeRef on __Type {
-    kind
-    name
-    ofType {
-      kind
-      name
-      ofType {
-        kind
-        name
-        ofType {
-          kind
-          name
-          ofType {
-            kind
-            name
-            ofType {
-              kind
-              name
-              ofType {
-                kind
-                name
-                ofType {
-                  kind
-                  name
-                }
-              }
-            }
-          }
-        }
-      }
-    }
-  }
-`
+  %s
+`, schemaFields, directiveFields, includeDeprecated, typeFields, includeDeprecated, includeDeprecated, inputValueFields, typeRefFragment(typeRefDepth))
+}
+
+// typeRefDepth is the number of type wrapping levels resolved by the
+// introspection query, enough for [[Int!]!]!. Deeper types are resolved by
+// follow-up queries resolving deepTypeRefDepth levels.
+const (
+	typeRefDepth     = 8
+	deepTypeRefDepth = 64
+)
+
+// typeRefFragment builds the TypeRef fragment resolving depth levels of the
+// LIST and NON_NULL wrappers of a type.
+func typeRefFragment(depth int) string {
+	selection := "kind name"
+	for i := 1; i < depth; i++ {
+		selection = fmt.Sprintf("kind name ofType { %s }", selection)
+	}
+	return fmt.Sprintf("fragment TypeRef on __Type { %s }", selection)
+}
 
 type IntrospectionOfType struct {
 	Kind   string               `json:"kind"`
@@ -115,6 +195,10 @@ type IntrospectionType struct {
 	EnumValues    []*IntrospectionEnumValue  `json:"enumValues"`
 	PossibleTypes []*IntrospectionTypeRef    `json:"possibleTypes"`
 	OfType        *IntrospectionOfType       `json:"ofType"`
+	// SpecifiedByURL links the specification of a custom scalar.
+	SpecifiedByURL string `json:"specifiedByURL,omitempty"`
+	// IsOneOf is set on input objects of which exactly one field is given.
+	IsOneOf bool `json:"isOneOf,omitempty"`
 }
 
 type IntrospectionTypeRef struct {
@@ -133,10 +217,12 @@ type IntrospectionField struct {
 }
 
 type IntrospectionInputValue struct {
-	Name         string                `json:"name"`
-	Description  string                `json:"description"`
-	Type         *IntrospectionTypeRef `json:"type"`
-	DefaultValue string                `json:"defaultValue"`
+	Name              string                `json:"name"`
+	Description       string                `json:"description"`
+	Type              *IntrospectionTypeRef `json:"type"`
+	DefaultValue      string                `json:"defaultValue"`
+	IsDeprecated      bool                  `json:"isDeprecated,omitempty"`
+	DeprecationReason string                `json:"deprecationReason,omitempty"`
 }
 
 type IntrospectionEnumValue struct {
@@ -151,11 +237,22 @@ type IntrospectionDirective struct {
 	Description string                     `json:"description"`
 	Locations   []string                   `json:"locations"`
 	Args        []*IntrospectionInputValue `json:"args"`
+	// IsRepeatable is set on directives which may be used more than once at
+	// the same location.
+	IsRepeatable bool `json:"isRepeatable,omitempty"`
+}
+
+type IntrospectionRootType struct {
+	Name string `json:"name"`
 }
 
 type IntrospectionSchema struct {
-	Types      []*IntrospectionType      `json:"types"`
-	Directives []*IntrospectionDirective `json:"directives"`
+	Description      string                    `json:"description,omitempty"`
+	QueryType        *IntrospectionRootType    `json:"queryType"`
+	MutationType     *IntrospectionRootType    `json:"mutationType"`
+	SubscriptionType *IntrospectionRootType    `json:"subscriptionType"`
+	Types            []*IntrospectionType      `json:"types"`
+	Directives       []*IntrospectionDirective `json:"directives"`
 }
 
 type IntrospectionQueryData struct {
@@ -170,14 +267,88 @@ type Introspection struct {
 	Endpoint string
 }
 
-func getIntrospection(endpoint string) (*Introspection, error) {
-	client := resty.New()
-	resp, err := client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(map[string]string{
-			"query": introspectionQuery,
-		}).
-		Post(endpoint)
+// Introspect runs the introspection query against endpoint, the result can
+// be saved with Save to create clients later without the round trip.
+func Introspect(endpoint string, opts ...Option) (*Introspection, error) {
+	return getIntrospection(context.Background(), endpoint, newOptions(opts))
+}
+
+// MarshalJSON encodes the schema as a standard introspection response,
+// {"data":{"__schema":...}}. The endpoint is not part of it.
+func (i *Introspection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(IntrospectionQuery{
+		Data: &IntrospectionQueryData{Schema: i.Schema},
+	})
+}
+
+// UnmarshalJSON decodes an introspection response, either complete or just
+// its data as written by tools like get-graphql-schema --json.
+func (i *Introspection) UnmarshalJSON(b []byte) error {
+	var result struct {
+		IntrospectionQueryData
+		Data *IntrospectionQueryData `json:"data"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+	schema := result.Schema
+	if result.Data != nil {
+		schema = result.Data.Schema
+	}
+	if schema == nil {
+		return errors.New("__schema not found")
+	}
+	i.Schema = schema
+	return nil
+}
+
+// Save writes the introspection result to path as json.
+func (i *Introspection) Save(path string) error {
+	b, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// LoadIntrospection reads an introspection result saved as json, its
+// Endpoint is left empty.
+func LoadIntrospection(path string) (*Introspection, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var introspection Introspection
+	if err := json.Unmarshal(b, &introspection); err != nil {
+		return nil, fmt.Errorf("invalid introspection %s: %w", path, err)
+	}
+	if err := introspection.Schema.checkTypeRefs(); err != nil {
+		return nil, fmt.Errorf("invalid introspection %s: %w", path, err)
+	}
+	return &introspection, nil
+}
+
+// NewClientFromIntrospectionFile creates a client for endpoint from an
+// introspection result saved as json instead of introspecting it.
+func NewClientFromIntrospectionFile(endpoint string, path string, opts ...Option) (*GraphqlClient, error) {
+	introspection, err := LoadIntrospection(path)
+	if err != nil {
+		return nil, err
+	}
+	introspection.Endpoint = endpoint
+	return NewClientFromIntrospection(introspection, opts...)
+}
+
+func getIntrospection(ctx context.Context, endpoint string, options *options) (*Introspection, error) {
+	introspectionEndpoint := endpoint
+	if options.introspectionEndpoint != "" {
+		introspectionEndpoint = options.introspectionEndpoint
+	}
+	features, err := getIntrospectionFeatures(ctx, introspectionEndpoint, options)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postIntrospection(ctx, introspectionEndpoint, options, features.query())
 	if err != nil {
 		return nil, err
 	}
@@ -186,11 +357,169 @@ func getIntrospection(endpoint string) (*Introspection, error) {
 	if err != nil {
 		return nil, err
 	}
-	if result.Data == nil {
+	if result.Data == nil || result.Data.Schema == nil {
 		return nil, errors.New("invaild response")
 	}
+	if err := resolveTypeRefs(ctx, introspectionEndpoint, options, features, result.Data.Schema); err != nil {
+		return nil, err
+	}
+	if err := result.Data.Schema.checkTypeRefs(); err != nil {
+		return nil, err
+	}
 	return &Introspection{
 		Schema:   result.Data.Schema,
 		Endpoint: endpoint,
 	}, nil
 }
+
+// getIntrospectionFeatures asks the server which features of the
+// introspection schema it supports. Servers rejecting the question are
+// introspected with the fields every server supports.
+func getIntrospectionFeatures(ctx context.Context, endpoint string, options *options) (introspectionFeatures, error) {
+	resp, err := postIntrospection(ctx, endpoint, options, introspectionFeaturesQuery)
+	var transportError *TransportError
+	if errors.As(err, &transportError) {
+		return introspectionFeatures{}, err
+	}
+	if err != nil {
+		return introspectionFeatures{}, nil
+	}
+	result := gjson.ParseBytes(resp.Body())
+	if result.Get("errors").Exists() || !result.Get("data").IsObject() {
+		return introspectionFeatures{}, nil
+	}
+	return parseIntrospectionFeatures(result.Get("data")), nil
+}
+
+func postIntrospection(ctx context.Context, endpoint string, options *options, query string) (*resty.Response, error) {
+	resp, err := options.client.R().
+		SetContext(ctx).
+		SetHeaders(options.headers).
+		SetHeaders(options.introspectionHeaders).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]string{
+			"query": query,
+		}).
+		Post(endpoint)
+	if err != nil {
+		return nil, &TransportError{Err: err}
+	}
+	if !resp.IsSuccess() {
+		return nil, newHTTPError(resp.RawResponse, resp.Body())
+	}
+	return resp, nil
+}
+
+// truncated reports whether the chain of LIST and NON_NULL wrappers ends
+// before the named type, which happens when a type is nested deeper than the
+// introspection query resolves.
+func (t *IntrospectionTypeRef) truncated() bool {
+	if t == nil {
+		return true
+	}
+	kind, ofType := t.Kind, t.OfType
+	for kind == "LIST" || kind == "NON_NULL" {
+		if ofType == nil {
+			return true
+		}
+		kind, ofType = ofType.Kind, ofType.OfType
+	}
+	return false
+}
+
+// visitTypeRefs calls visit for every type reference which may be wrapped,
+// with the name of the type or directive owning it and its schema
+// coordinate, e.g. User.friends, User.friends(first:) or @auth(role:).
+func (s *IntrospectionSchema) visitTypeRefs(visit func(owner string, path string, ref **IntrospectionTypeRef)) {
+	for _, t := range s.Types {
+		for _, field := range t.Fields {
+			path := t.Name + "." + field.Name
+			visit(t.Name, path, &field.Type)
+			for _, arg := range field.Args {
+				visit(t.Name, fmt.Sprintf("%s(%s:)", path, arg.Name), &arg.Type)
+			}
+		}
+		for _, field := range t.InputFields {
+			visit(t.Name, t.Name+"."+field.Name, &field.Type)
+		}
+	}
+	for _, directive := range s.Directives {
+		for _, arg := range directive.Args {
+			visit("@"+directive.Name, fmt.Sprintf("@%s(%s:)", directive.Name, arg.Name), &arg.Type)
+		}
+	}
+}
+
+// checkTypeRefs returns an error for the first type reference which does not
+// end in a named type, documents can not be built from it.
+func (s *IntrospectionSchema) checkTypeRefs() error {
+	var err error
+	s.visitTypeRefs(func(owner string, path string, ref **IntrospectionTypeRef) {
+		if err == nil && (*ref).truncated() {
+			err = fmt.Errorf("type of %s is incomplete, its LIST and NON_NULL wrappers are cut off", path)
+		}
+	})
+	return err
+}
+
+// resolveTypeRefs completes the type references nested deeper than the
+// introspection query resolves with a follow-up query for the types and
+// directives having them.
+func resolveTypeRefs(ctx context.Context, endpoint string, options *options, features introspectionFeatures, schema *IntrospectionSchema) error {
+	owners := make([]string, 0)
+	schema.visitTypeRefs(func(owner string, path string, ref **IntrospectionTypeRef) {
+		if (*ref).truncated() && !contains(owners, owner) {
+			owners = append(owners, owner)
+		}
+	})
+	if len(owners) == 0 {
+		return nil
+	}
+	includeDeprecated := features.includeDeprecated()
+	selections := make([]string, 0, len(owners))
+	directives := false
+	for i, owner := range owners {
+		if strings.HasPrefix(owner, "@") {
+			directives = true
+			continue
+		}
+		selections = append(selections, fmt.Sprintf(
+			"type%d: __type(name: %q) { name fields(includeDeprecated: true) { name type { ...TypeRef } args%s { name type { ...TypeRef } } } inputFields%s { name type { ...TypeRef } } }",
+			i, owner, includeDeprecated, includeDeprecated))
+	}
+	if directives {
+		selections = append(selections, fmt.Sprintf("__schema { directives { name args%s { name type { ...TypeRef } } } }", includeDeprecated))
+	}
+	query := fmt.Sprintf("query IntrospectionTypeRefs { %s } %s", strings.Join(selections, " "), typeRefFragment(deepTypeRefDepth))
+	resp, err := postIntrospection(ctx, endpoint, options, query)
+	if err != nil {
+		return fmt.Errorf("resolving nested types: %w", err)
+	}
+	result := gjson.ParseBytes(resp.Body())
+	if errs := result.Get("errors"); errs.Exists() {
+		return fmt.Errorf("resolving nested types: %w", parseGraphQLErrors(errs.Raw))
+	}
+	var resolved IntrospectionSchema
+	for key, value := range result.Get("data").Map() {
+		if key == "__schema" {
+			err = json.Unmarshal([]byte(value.Get("directives").Raw), &resolved.Directives)
+		} else if value.IsObject() {
+			var t IntrospectionType
+			err = json.Unmarshal([]byte(value.Raw), &t)
+			resolved.Types = append(resolved.Types, &t)
+		}
+		if err != nil {
+			return fmt.Errorf("resolving nested types: %w", err)
+		}
+	}
+	refs := make(map[string]*IntrospectionTypeRef)
+	resolved.visitTypeRefs(func(owner string, path string, ref **IntrospectionTypeRef) {
+		refs[path] = *ref
+	})
+	schema.visitTypeRefs(func(owner string, path string, ref **IntrospectionTypeRef) {
+		if resolvedRef, ok := refs[path]; ok && (*ref).truncated() {
+			*ref = resolvedRef
+		}
+	})
+	return nil
+}
@@ -0,0 +1,235 @@
+package dgql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestIntrospectionSnapshot(t *testing.T) {
+	server := newTestServer(t, newRecursiveSchema(t))
+	introspection, err := dgql.Introspect(server.URL)
+	if !assert.NoError(t, err, "Error introspecting") {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if !assert.NoError(t, introspection.Save(path)) {
+		return
+	}
+	saved, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Query", gjson.GetBytes(saved, "data.__schema.queryType.name").String())
+
+	client, err := dgql.NewClientFromIntrospectionFile(server.URL, path)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	resp, _, err := client.Query(context.Background(), "me", nil, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "dgql", resp.Get("me.name").String())
+
+	// tools like get-graphql-schema --json write the data without envelope
+	dataOnly := filepath.Join(t.TempDir(), "data.json")
+	assert.NoError(t, os.WriteFile(dataOnly, []byte(gjson.GetBytes(saved, "data").Raw), 0644))
+	loaded, err := dgql.LoadIntrospection(dataOnly)
+	if assert.NoError(t, err) {
+		expected, _ := json.Marshal(introspection)
+		actual, _ := json.Marshal(loaded)
+		assert.JSONEq(t, string(expected), string(actual))
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	assert.NoError(t, os.WriteFile(invalid, []byte(`{"data":null}`), 0644))
+	_, err = dgql.LoadIntrospection(invalid)
+	assert.Error(t, err)
+}
+
+// newRecordedServer answers the feature probe and the introspection query
+// with the responses recorded in testdata, the probe fails when probe is
+// empty. The last introspection query is stored in query.
+func newRecordedServer(t *testing.T, probe string, response string, query *string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var p struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		path := response
+		if strings.Contains(p.Query, "IntrospectionFeatures") {
+			path = probe
+		} else {
+			*query = p.Query
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if path == "" {
+			w.Write([]byte(`{"errors":[{"message":"Cannot query field \"__type\" on type \"Query\"."}]}`))
+			return
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", path))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIntrospectionFeatures(t *testing.T) {
+	var query string
+	server := newRecordedServer(t, "introspection_features_modern.json", "introspection_modern.json", &query)
+	introspection, err := dgql.Introspect(server.URL)
+	if !assert.NoError(t, err, "Error introspecting") {
+		return
+	}
+	for _, field := range []string{"description", "specifiedByURL", "isOneOf", "isRepeatable", "args(includeDeprecated: true)", "inputFields(includeDeprecated: true)", "isDeprecated\n    deprecationReason\n  }\n\n  fragment TypeRef"} {
+		assert.Contains(t, query, field)
+	}
+	assert.Equal(t, `"Items of the catalog"
+schema {
+  query: Query
+}
+
+directive @tag(name: String!) repeatable on FIELD_DEFINITION | OBJECT
+
+"An ISO 8601 date time"
+scalar DateTime @specifiedBy(url: "https://scalars.graphql.org/andimarek/date-time")
+
+type Item {
+  id: ID!
+  title: String
+  updatedAt: DateTime
+}
+
+input Lookup @oneOf {
+  id: ID
+  slug: String
+}
+
+type Query {
+  item(lookup: Lookup!, legacyId: ID @deprecated(reason: "use lookup")): Item
+}
+`, introspection.Schema.SDL())
+
+	// servers predating the features are asked only for what they support
+	server = newRecordedServer(t, "introspection_features_legacy.json", "introspection_legacy.json", &query)
+	introspection, err = dgql.Introspect(server.URL)
+	if !assert.NoError(t, err, "Error introspecting") {
+		return
+	}
+	for _, field := range []string{"specifiedByURL", "isOneOf", "isRepeatable", "includeDeprecated: true) {\n          ...InputValue"} {
+		assert.NotContains(t, query, field)
+	}
+	assert.Contains(t, introspection.Schema.SDL(), "name: String @deprecated(reason: \"use title\")")
+
+	// as are servers rejecting the probe
+	server = newRecordedServer(t, "", "introspection_legacy.json", &query)
+	_, err = dgql.Introspect(server.URL)
+	assert.NoError(t, err, "Error introspecting")
+	assert.NotContains(t, query, "isRepeatable")
+}
+
+func TestDeeplyNestedTypes(t *testing.T) {
+	// [[[[String!]!]!]!]! has ten levels, more than the introspection query resolves
+	deep := graphql.Output(graphql.String)
+	for i := 0; i < 4; i++ {
+		deep = graphql.NewList(graphql.NewNonNull(deep))
+	}
+	deep = graphql.NewNonNull(deep)
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"matrix": &graphql.Field{
+					Type: deep,
+					Args: graphql.FieldConfigArgument{
+						"input": &graphql.ArgumentConfig{Type: deep.(graphql.Input)},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Args["input"], nil
+					},
+				},
+			},
+		}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	handler := newTestHandler(schema)
+	var rejectFollowUp atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if rejectFollowUp.Load() && strings.Contains(string(body), "IntrospectionTypeRefs") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"errors":[{"message":"query too complex"}]}`))
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, _, err := client.Document(dgql.OperationQuery, "matrix")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query matrix($input: [[[[String!]!]!]!]!) { matrix(input: $input) }", document)
+	}
+	matrix := [][][][]string{{{{"a"}}}}
+	resp, _, err := client.Query(context.Background(), "matrix", map[string]interface{}{"input": matrix}, nil)
+	if assert.NoError(t, err, "Error querying") {
+		assert.Equal(t, `[[[["a"]]]]`, resp.Get("matrix").Raw)
+	}
+
+	rejectFollowUp.Store(true)
+	_, err = dgql.NewClient(server.URL)
+	assert.EqualError(t, err, "resolving nested types: graphql: query too complex")
+}
+
+func TestTruncatedTypes(t *testing.T) {
+	sdl := `type Query { matrix(input: [String!]!): [String!]! }`
+	schema, err := dgql.ParseSDL(sdl)
+	if !assert.NoError(t, err, "Error parsing schema") {
+		return
+	}
+	before := &dgql.Introspection{Schema: schema}
+	truncated, err := dgql.ParseSDL(sdl)
+	if !assert.NoError(t, err, "Error parsing schema") {
+		return
+	}
+	// NON_NULL(LIST(...)) whose item type was cut off
+	truncated.Types[0].Fields[0].Type.OfType.OfType = nil
+	truncated.Types[0].Fields[0].Args[0].Type.OfType.OfType = nil
+	after := &dgql.Introspection{Schema: truncated}
+	_, err = dgql.NewClientFromIntrospection(after)
+	assert.EqualError(t, err, "type of Query.matrix is incomplete, its LIST and NON_NULL wrappers are cut off")
+	assert.NotPanics(t, func() {
+		assert.NotEmpty(t, dgql.DiffSchema(before, after))
+		dgql.DiffSchema(after, before)
+		dgql.AffectedOperations(before, after)
+		dgql.AffectedOperations(after, before)
+		truncated.SDL()
+	})
+}
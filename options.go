@@ -0,0 +1,259 @@
+package dgql
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Option configures a GraphqlClient when it is created.
+type Option func(*options)
+
+type options struct {
+	maxDepth                 int
+	subscriptionTransport    SubscriptionTransport
+	reconnectAttempts        int
+	reconnectDelay           time.Duration
+	headers                  map[string]string
+	httpClient               *http.Client
+	client                   *resty.Client
+	timeout                  time.Duration
+	introspectionHeaders     map[string]string
+	introspectionEndpoint    string
+	refreshInterval          time.Duration
+	refreshOnValidationError bool
+	schemaChangeHandler      func(SchemaChange)
+	getQueries               bool
+	maxURLLength             int
+	cacheEntries             int
+	persistedQueries         bool
+}
+
+func newOptions(opts []Option) *options {
+	var result = &options{
+		maxDepth:             DefaultMaxDepth,
+		reconnectAttempts:    defaultReconnectAttempts,
+		reconnectDelay:       defaultReconnectDelay,
+		headers:              make(map[string]string),
+		introspectionHeaders: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(result)
+	}
+	// the same client is used for introspection and for operations
+	if result.client == nil {
+		if result.httpClient != nil {
+			// a copy, so the timeout is not set on a client shared elsewhere
+			httpClient := *result.httpClient
+			result.client = resty.NewWithClient(&httpClient)
+		} else {
+			result.client = resty.New()
+		}
+		setContentLength(result.client)
+	}
+	if result.maxDepth == 0 {
+		result.maxDepth = DefaultMaxDepth
+	}
+	if result.maxURLLength <= 0 {
+		result.maxURLLength = DefaultMaxURLLength
+	}
+	if result.timeout > 0 {
+		result.client.SetTimeout(result.timeout)
+	}
+	return result
+}
+
+// validate rejects options no client can be built with.
+func (o *options) validate() error {
+	if o.maxDepth < 1 {
+		return fmt.Errorf("invalid max depth %d", o.maxDepth)
+	}
+	return nil
+}
+
+// WithHeaders adds headers sent with the introspection query and with every
+// operation, they become the client's DefaultHeaders.
+func WithHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		for k, v := range headers {
+			o.headers[k] = v
+		}
+	}
+}
+
+// WithHTTPClient makes the client send its requests with httpClient, e.g. to
+// configure TLS or a proxy.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithRestyClient makes the client send its requests with client, it takes
+// precedence over WithHTTPClient. Unlike the http client of WithHTTPClient
+// it is used as it is, so WithTimeout changes the timeout of client itself,
+// and uploads are sent without Content-Length as dgql leaves its pre request
+// hook alone.
+func WithRestyClient(client *resty.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithTimeout limits the duration of every request including introspection,
+// the http client of WithHTTPClient is left untouched. Subscriptions are only
+// limited while they are being started.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithIntrospectionHeaders adds headers sent only with the introspection
+// query, on top of the ones of WithHeaders.
+func WithIntrospectionHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		for k, v := range headers {
+			o.introspectionHeaders[k] = v
+		}
+	}
+}
+
+// WithIntrospectionEndpoint sends the introspection query to endpoint instead
+// of the endpoint operations are sent to.
+func WithIntrospectionEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.introspectionEndpoint = endpoint
+	}
+}
+
+// WithMaxDepth sets the number of nested selection sets generated for every
+// operation of the client, recursive types are never expanded into themselves.
+// Zero means DefaultMaxDepth, negative depths are rejected by NewClient.
+func WithMaxDepth(depth int) Option {
+	return func(o *options) {
+		o.maxDepth = depth
+	}
+}
+
+// WithSubscriptionTransport sets the protocol used by Subscribe,
+// GraphQLTransportWS by default.
+func WithSubscriptionTransport(transport SubscriptionTransport) Option {
+	return func(o *options) {
+		o.subscriptionTransport = transport
+	}
+}
+
+// WithReconnect sets how often Subscribe tries to resubscribe after the
+// connection was lost and the delay before the first try, which doubles with
+// every failed try. Zero attempts disable reconnecting.
+func WithReconnect(attempts int, delay time.Duration) Option {
+	return func(o *options) {
+		o.reconnectAttempts = attempts
+		o.reconnectDelay = delay
+	}
+}
+
+// WithSchemaRefresh introspects the endpoint every interval and regenerates
+// the documents of the client when the schema changed. The refresh runs in
+// the background until Close is called.
+func WithSchemaRefresh(interval time.Duration) Option {
+	return func(o *options) {
+		o.refreshInterval = interval
+	}
+}
+
+// WithRefreshOnValidationError refreshes the schema in the background when
+// the server rejects a generated document because of an unknown field, at
+// most once every 10 seconds.
+func WithRefreshOnValidationError() Option {
+	return func(o *options) {
+		o.refreshOnValidationError = true
+	}
+}
+
+// WithSchemaChangeHandler calls handler whenever a refresh replaced the
+// schema of the client.
+func WithSchemaChangeHandler(handler func(SchemaChange)) Option {
+	return func(o *options) {
+		o.schemaChangeHandler = handler
+	}
+}
+
+// WithGetQueries sends queries as GET requests with query, operationName and
+// variables as url parameters, so CDNs and proxies can cache them. Queries
+// whose url would be longer than maxURLLength, DefaultMaxURLLength when 0,
+// are posted as before. Mutations are always posted.
+func WithGetQueries(maxURLLength int) Option {
+	return func(o *options) {
+		o.getQueries = true
+		o.maxURLLength = maxURLLength
+	}
+}
+
+// WithHTTPCache keeps up to maxEntries responses to GET queries in memory.
+// They are reused as long as their Cache-Control max-age or Expires header
+// allows and revalidated with If-None-Match when they carry an ETag. It only
+// has an effect together with WithGetQueries.
+func WithHTTPCache(maxEntries int) Option {
+	return func(o *options) {
+		o.cacheEntries = maxEntries
+	}
+}
+
+// WithPersistedQueries sends the operations of the client as automatic
+// persisted queries: only the sha256 hash of the document is sent, and the
+// document is sent along with it when the server answers
+// PersistedQueryNotFound. Hashes the server accepted are sent as GET
+// requests with WithGetQueries, the others are posted so no CDN caches the
+// error. Servers answering PersistedQueryNotSupported, or executing the
+// document only when it is sent along, get plain requests.
+func WithPersistedQueries() Option {
+	return func(o *options) {
+		o.persistedQueries = true
+	}
+}
+
+// CallOption configures a single Query, Mutation or UploadMutation call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	maxDepth int
+	include  []string
+	exclude  []string
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	var result = &callOptions{}
+	for _, opt := range opts {
+		opt(result)
+	}
+	return result
+}
+
+// WithDepth overrides the client's max depth for one call, zero keeps it.
+func WithDepth(depth int) CallOption {
+	return func(o *callOptions) {
+		if depth != 0 {
+			o.maxDepth = depth
+		}
+	}
+}
+
+// WithFields selects only the given fields of the operation's return type,
+// as dotted paths like "id" or "owner.name". A path ending at an object field
+// selects that object as it would be generated by default.
+func WithFields(paths ...string) CallOption {
+	return func(o *callOptions) {
+		o.include = append(o.include, paths...)
+	}
+}
+
+// WithoutFields leaves the given dotted paths out of the generated selection.
+func WithoutFields(paths ...string) CallOption {
+	return func(o *callOptions) {
+		o.exclude = append(o.exclude, paths...)
+	}
+}
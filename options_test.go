@@ -0,0 +1,97 @@
+package dgql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sczlog/dgql"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientOptions(t *testing.T) {
+	schema, _ := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"hello": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return "world", nil
+					},
+				},
+			},
+		}),
+	})
+	graphqlHandler := newTestHandler(schema)
+	var introspected int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(req.URL.Path, "/introspection") {
+			if req.Header.Get("X-Introspection") != "1" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			atomic.AddInt32(&introspected, 1)
+		}
+		if req.URL.Query().Get("slow") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		graphqlHandler.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	_, err := dgql.NewClient(server.URL)
+	var httpError *dgql.HTTPError
+	if assert.True(t, errors.As(err, &httpError)) {
+		assert.Equal(t, http.StatusUnauthorized, httpError.StatusCode)
+	}
+
+	transport := &countingTransport{}
+	client, err := dgql.NewClient(server.URL,
+		dgql.WithHeaders(map[string]string{"Authorization": "Bearer token"}),
+		dgql.WithHTTPClient(&http.Client{Transport: transport}),
+		dgql.WithIntrospectionEndpoint(server.URL+"/introspection"),
+		dgql.WithIntrospectionHeaders(map[string]string{"X-Introspection": "1"}),
+	)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	resp, _, err := client.Query(context.Background(), "hello", nil, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "world", resp.Get("hello").String())
+	// introspecting asks for the supported features first
+	assert.Equal(t, int32(2), atomic.LoadInt32(&introspected))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&transport.requests))
+
+	httpClient := &http.Client{}
+	_, err = dgql.NewClient(server.URL+"?slow=1",
+		dgql.WithHeaders(map[string]string{"Authorization": "Bearer token"}),
+		dgql.WithHTTPClient(httpClient),
+		dgql.WithTimeout(50*time.Millisecond),
+	)
+	var transportError *dgql.TransportError
+	assert.True(t, errors.As(err, &transportError), "Expected timeout")
+	// the timeout applies to a copy of the http client
+	assert.Zero(t, httpClient.Timeout)
+}
@@ -0,0 +1,101 @@
+package dgql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	persistedQueryNotFound     = "PersistedQueryNotFound"
+	persistedQueryNotSupported = "PersistedQueryNotSupported"
+)
+
+// persistedQueries holds the state of automatic persisted queries of a
+// client.
+type persistedQueries struct {
+	// accepted holds the hashes the server knows the document of
+	accepted sync.Map
+	// unsupported is set once the server answered PersistedQueryNotSupported
+	// or only executed the document when it was sent
+	unsupported atomic.Bool
+}
+
+// sendPersisted sends the hash of a document and, when the server does not
+// know it yet, the document together with its hash to register it. A hash is
+// only taken as known once the server answered it with data.
+func (c *GraphqlClient) sendPersisted(ctx context.Context, operation string, document string, operationName string, variables interface{}, headers *map[string]string) (*gjson.Result, *http.Header, error) {
+	hash := persistedQueryHash(document)
+	body := newOperations("", operationName, variables)
+	body.Extensions = map[string]interface{}{
+		"persistedQuery": map[string]interface{}{
+			"version":    1,
+			"sha256Hash": hash,
+		},
+	}
+	method := operation
+	_, accepted := c.persisted.accepted.Load(hash)
+	if !accepted {
+		// a GET for an unknown hash could have its error cached
+		method = ""
+	}
+	data, header, err := c.sendOperations(ctx, method, body, headers)
+	var transportError *TransportError
+	switch {
+	case persistedQueryError(err) == persistedQueryNotSupported:
+		c.persisted.unsupported.Store(true)
+		return c.sendOperations(ctx, operation, newOperations(document, operationName, variables), headers)
+	case data != nil:
+		c.persisted.accepted.Store(hash, struct{}{})
+		return data, header, err
+	case errors.As(err, &transportError):
+		return data, header, err
+	}
+	// the server forgot or never knew the document, or does not support
+	// persisted queries without saying so
+	notFound := persistedQueryError(err) == persistedQueryNotFound
+	c.persisted.accepted.Delete(hash)
+	body.Query = document
+	data, header, err = c.sendOperations(ctx, "", body, headers)
+	if data != nil {
+		if notFound {
+			c.persisted.accepted.Store(hash, struct{}{})
+		} else if !accepted {
+			// the document was executed where its hash alone failed, the
+			// server ignores the hash
+			c.persisted.unsupported.Store(true)
+		}
+	}
+	return data, header, err
+}
+
+func persistedQueryHash(document string) string {
+	sum := sha256.Sum256([]byte(document))
+	return hex.EncodeToString(sum[:])
+}
+
+// persistedQueryError returns PersistedQueryNotFound or
+// PersistedQueryNotSupported when err contains one of them, as message or
+// as extensions code like PERSISTED_QUERY_NOT_FOUND.
+func persistedQueryError(err error) string {
+	var errs GraphQLErrors
+	if !errors.As(err, &errs) {
+		return ""
+	}
+	for _, e := range errs {
+		code, _ := e.Extensions["code"].(string)
+		switch {
+		case e.Message == persistedQueryNotFound || code == "PERSISTED_QUERY_NOT_FOUND":
+			return persistedQueryNotFound
+		case e.Message == persistedQueryNotSupported || code == "PERSISTED_QUERY_NOT_SUPPORTED":
+			return persistedQueryNotSupported
+		}
+	}
+	return ""
+}
@@ -0,0 +1,246 @@
+package dgql_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+// persistedRequest is a request received by newPersistedServer.
+type persistedRequest struct {
+	Method   string
+	HasQuery bool
+	HasHash  bool
+}
+
+// newPersistedServer answers requests like newCachingServer and keeps the
+// documents registered by their hash. Without support it answers every
+// persisted query with PersistedQueryNotSupported.
+func newPersistedServer(t *testing.T, support bool) (*httptest.Server, func() []persistedRequest, func()) {
+	var mu sync.Mutex
+	var requests []persistedRequest
+	documents := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Query      string                 `json:"query"`
+			Variables  map[string]interface{} `json:"variables"`
+			Extensions struct {
+				PersistedQuery struct {
+					Version    int    `json:"version"`
+					Sha256Hash string `json:"sha256Hash"`
+				} `json:"persistedQuery"`
+			} `json:"extensions"`
+		}
+		if req.Method == http.MethodGet {
+			body.Query = req.URL.Query().Get("query")
+			json.Unmarshal([]byte(req.URL.Query().Get("variables")), &body.Variables)
+			json.Unmarshal([]byte(req.URL.Query().Get("extensions")), &body.Extensions)
+		} else {
+			json.NewDecoder(req.Body).Decode(&body)
+		}
+		hash := body.Extensions.PersistedQuery.Sha256Hash
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, persistedRequest{Method: req.Method, HasQuery: body.Query != "", HasHash: hash != ""})
+		w.Header().Set("Content-Type", "application/json")
+		reject := func(message string, code string) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": []interface{}{map[string]interface{}{"message": message, "extensions": map[string]string{"code": code}}},
+			})
+		}
+		if hash != "" {
+			switch {
+			case !support:
+				reject("PersistedQueryNotSupported", "PERSISTED_QUERY_NOT_SUPPORTED")
+				return
+			case body.Query != "":
+				sum := sha256.Sum256([]byte(body.Query))
+				if hex.EncodeToString(sum[:]) != hash {
+					reject("provided sha does not match query", "INTERNAL_SERVER_ERROR")
+					return
+				}
+				documents[hash] = body.Query
+			case documents[hash] == "":
+				reject("PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND")
+				return
+			default:
+				body.Query = documents[hash]
+			}
+		}
+		field, argument := "user", "id"
+		if strings.HasPrefix(strings.TrimSpace(body.Query), "mutation") {
+			field, argument = "rename", "name"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{field: body.Variables[argument]}})
+	}))
+	t.Cleanup(server.Close)
+	received := func() []persistedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		result := requests
+		requests = nil
+		return result
+	}
+	forget := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		documents = make(map[string]string)
+	}
+	return server, received, forget
+}
+
+func TestPersistedQueries(t *testing.T) {
+	server, received, forget := newPersistedServer(t, true)
+	client, err := dgql.NewClientFromSDL(server.URL, getSchema, dgql.WithPersistedQueries(), dgql.WithGetQueries(0))
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	query := func() {
+		resp, _, err := client.Query(context.Background(), "user", map[string]interface{}{"id": "1"}, nil)
+		if assert.NoError(t, err, "Error querying") {
+			assert.Equal(t, "1", resp.Get("user").String())
+		}
+	}
+	mutate := func() {
+		resp, _, err := client.Mutation(context.Background(), "rename", map[string]interface{}{"name": "dgql"}, nil)
+		if assert.NoError(t, err, "Error mutating") {
+			assert.Equal(t, "dgql", resp.Get("rename").String())
+		}
+	}
+	query()
+	query()
+	mutate()
+	mutate()
+	assert.Equal(t, []persistedRequest{
+		// unknown hashes are posted and registered
+		{Method: http.MethodPost, HasHash: true},
+		{Method: http.MethodPost, HasQuery: true, HasHash: true},
+		// accepted hashes of queries are sent as GET
+		{Method: http.MethodGet, HasHash: true},
+		{Method: http.MethodPost, HasHash: true},
+		{Method: http.MethodPost, HasQuery: true, HasHash: true},
+		{Method: http.MethodPost, HasHash: true},
+	}, received())
+
+	// the server lost its documents, e.g. after a restart
+	forget()
+	query()
+	query()
+	assert.Equal(t, []persistedRequest{
+		{Method: http.MethodGet, HasHash: true},
+		{Method: http.MethodPost, HasQuery: true, HasHash: true},
+		{Method: http.MethodGet, HasHash: true},
+	}, received())
+}
+
+func TestPersistedQueriesNotSupported(t *testing.T) {
+	server, received, _ := newPersistedServer(t, false)
+	client, err := dgql.NewClientFromSDL(server.URL, getSchema, dgql.WithPersistedQueries())
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		resp, _, err := client.Query(context.Background(), "user", map[string]interface{}{"id": "1"}, nil)
+		if assert.NoError(t, err, "Error querying") {
+			assert.Equal(t, "1", resp.Get("user").String())
+		}
+	}
+	assert.Equal(t, []persistedRequest{
+		{Method: http.MethodPost, HasHash: true},
+		{Method: http.MethodPost, HasQuery: true},
+		{Method: http.MethodPost, HasQuery: true},
+	}, received())
+}
+
+func TestPersistedQueriesFailedRequest(t *testing.T) {
+	backend, received, _ := newPersistedServer(t, true)
+	target, _ := url.Parse(backend.URL)
+	var failing atomic.Bool
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		proxy.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	client, err := dgql.NewClientFromSDL(server.URL, getSchema, dgql.WithPersistedQueries(), dgql.WithGetQueries(0))
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	query := func() error {
+		_, _, err := client.Query(context.Background(), "user", map[string]interface{}{"id": "1"}, nil)
+		return err
+	}
+	failing.Store(true)
+	var httpError *dgql.HTTPError
+	assert.True(t, errors.As(query(), &httpError), "Expected http error")
+	failing.Store(false)
+	assert.NoError(t, query())
+	assert.NoError(t, query())
+	assert.Equal(t, []persistedRequest{
+		// the server never saw the hash of the failed request, so it is
+		// still posted
+		{Method: http.MethodPost, HasHash: true},
+		{Method: http.MethodPost, HasQuery: true, HasHash: true},
+		{Method: http.MethodGet, HasHash: true},
+	}, received())
+}
+
+func TestPersistedQueriesIgnored(t *testing.T) {
+	// a server without persisted queries answering the hash alone with
+	// "Must provide an operation."
+	handler := newTestHandler(newVersionedSchema(t, 1))
+	var mu sync.Mutex
+	var requests []persistedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		requests = append(requests, persistedRequest{
+			Method:   req.Method,
+			HasQuery: gjson.GetBytes(body, "query").String() != "",
+			HasHash:  gjson.GetBytes(body, "extensions.persistedQuery").Exists(),
+		})
+		mu.Unlock()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	client, err := dgql.NewClient(server.URL, dgql.WithPersistedQueries())
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	mu.Lock()
+	requests = nil
+	mu.Unlock()
+	for i := 0; i < 2; i++ {
+		resp, _, err := client.Query(context.Background(), "me", nil, nil)
+		if assert.NoError(t, err, "Error querying") {
+			assert.Equal(t, "dgql", resp.Get("me.name").String())
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []persistedRequest{
+		{Method: http.MethodPost, HasHash: true},
+		{Method: http.MethodPost, HasQuery: true, HasHash: true},
+		{Method: http.MethodPost, HasQuery: true},
+	}, requests)
+}
@@ -0,0 +1,223 @@
+package dgql
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinDirectives are defined by the graphql specification and left out
+// when printing a schema.
+var builtinDirectives = []string{"skip", "include", "deprecated", "specifiedBy"}
+
+// defaultDeprecationReason is the reason of a bare @deprecated directive.
+const defaultDeprecationReason = "No longer supported"
+
+// SDL renders the schema in the graphql schema definition language. Types and
+// directives are sorted by name and builtin definitions are left out, so the
+// output of two introspections of the same schema is identical and can be
+// diffed and checked in.
+func (s *IntrospectionSchema) SDL() string {
+	blocks := make([]string, 0)
+	if block := s.printSchemaBlock(); block != "" {
+		blocks = append(blocks, block)
+	}
+	directives := make([]*IntrospectionDirective, 0, len(s.Directives))
+	for _, directive := range s.Directives {
+		if !contains(builtinDirectives, directive.Name) {
+			directives = append(directives, directive)
+		}
+	}
+	sort.Slice(directives, func(i, j int) bool {
+		return directives[i].Name < directives[j].Name
+	})
+	for _, directive := range directives {
+		blocks = append(blocks, printDirective(directive))
+	}
+	types := make([]*IntrospectionType, 0, len(s.Types))
+	for _, t := range s.Types {
+		if strings.HasPrefix(t.Name, "__") || (t.Kind == "SCALAR" && contains(builtinScalars, t.Name)) {
+			continue
+		}
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+	for _, t := range types {
+		blocks = append(blocks, printType(t))
+	}
+	if len(blocks) == 0 {
+		return ""
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// printSchemaBlock prints the schema block, which is only needed when the
+// schema has a description or root types not named after their operation
+// types.
+func (s *IntrospectionSchema) printSchemaBlock() string {
+	roots := []struct {
+		operation string
+		root      *IntrospectionRootType
+		name      string
+	}{
+		{OperationQuery, s.QueryType, "Query"},
+		{OperationMutation, s.MutationType, "Mutation"},
+		{OperationSubscription, s.SubscriptionType, "Subscription"},
+	}
+	conventional := true
+	lines := make([]string, 0)
+	for _, root := range roots {
+		if root.root == nil {
+			continue
+		}
+		if root.root.Name != root.name {
+			conventional = false
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", root.operation, root.root.Name))
+	}
+	if conventional && s.Description == "" {
+		return ""
+	}
+	return fmt.Sprintf("%sschema {\n%s\n}", printDescription(s.Description, ""), strings.Join(lines, "\n"))
+}
+
+func printType(t *IntrospectionType) string {
+	var definition string
+	switch t.Kind {
+	case "SCALAR":
+		definition = fmt.Sprintf("scalar %s", t.Name)
+		if t.SpecifiedByURL != "" {
+			definition += fmt.Sprintf(" @specifiedBy(url: %s)", printString(t.SpecifiedByURL))
+		}
+	case "OBJECT":
+		definition = fmt.Sprintf("type %s%s%s", t.Name, printImplements(t.Interfaces), printFields(t.Fields))
+	case "INTERFACE":
+		definition = fmt.Sprintf("interface %s%s%s", t.Name, printImplements(t.Interfaces), printFields(t.Fields))
+	case "UNION":
+		names := make([]string, len(t.PossibleTypes))
+		for i, possibleType := range t.PossibleTypes {
+			names[i] = possibleType.Name
+		}
+		definition = fmt.Sprintf("union %s = %s", t.Name, strings.Join(names, " | "))
+	case "ENUM":
+		values := make([]string, len(t.EnumValues))
+		for i, value := range t.EnumValues {
+			values[i] = printDescription(value.Description, "  ") + "  " + value.Name + printDeprecated(value.IsDeprecated, value.DeprecationReason)
+		}
+		definition = fmt.Sprintf("enum %s {\n%s\n}", t.Name, strings.Join(values, "\n"))
+	case "INPUT_OBJECT":
+		fields := make([]string, len(t.InputFields))
+		for i, field := range t.InputFields {
+			fields[i] = printDescription(field.Description, "  ") + "  " + printInputValue(field)
+		}
+		var oneOf string
+		if t.IsOneOf {
+			oneOf = " @oneOf"
+		}
+		definition = fmt.Sprintf("input %s%s {\n%s\n}", t.Name, oneOf, strings.Join(fields, "\n"))
+	default:
+		definition = fmt.Sprintf("# unknown kind %s of %s", t.Kind, t.Name)
+	}
+	return printDescription(t.Description, "") + definition
+}
+
+func printImplements(interfaces []*IntrospectionTypeRef) string {
+	if len(interfaces) == 0 {
+		return ""
+	}
+	names := make([]string, len(interfaces))
+	for i, implemented := range interfaces {
+		names[i] = implemented.Name
+	}
+	return " implements " + strings.Join(names, " & ")
+}
+
+func printFields(fields []*IntrospectionField) string {
+	lines := make([]string, len(fields))
+	for i, field := range fields {
+		lines[i] = fmt.Sprintf("%s  %s%s: %s%s", printDescription(field.Description, "  "), field.Name, printArgs(field.Args, "  "), field.Type.typeRef(), printDeprecated(field.IsDeprecated, field.DeprecationReason))
+	}
+	return fmt.Sprintf(" {\n%s\n}", strings.Join(lines, "\n"))
+}
+
+// printArgs prints arguments on one line unless one of them has a description.
+func printArgs(args []*IntrospectionInputValue, indent string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	described := false
+	for _, arg := range args {
+		if arg.Description != "" {
+			described = true
+		}
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		if described {
+			values[i] = printDescription(arg.Description, indent+"  ") + indent + "  " + printInputValue(arg)
+		} else {
+			values[i] = printInputValue(arg)
+		}
+	}
+	if described {
+		return fmt.Sprintf("(\n%s\n%s)", strings.Join(values, "\n"), indent)
+	}
+	return fmt.Sprintf("(%s)", strings.Join(values, ", "))
+}
+
+func printInputValue(value *IntrospectionInputValue) string {
+	result := fmt.Sprintf("%s: %s", value.Name, value.Type.typeRef())
+	if value.DefaultValue != "" {
+		result += " = " + value.DefaultValue
+	}
+	return result + printDeprecated(value.IsDeprecated, value.DeprecationReason)
+}
+
+func printDirective(directive *IntrospectionDirective) string {
+	var repeatable string
+	if directive.IsRepeatable {
+		repeatable = " repeatable"
+	}
+	return fmt.Sprintf("%sdirective @%s%s%s on %s", printDescription(directive.Description, ""), directive.Name, printArgs(directive.Args, ""), repeatable, strings.Join(directive.Locations, " | "))
+}
+
+func printDeprecated(isDeprecated bool, reason string) string {
+	if !isDeprecated {
+		return ""
+	}
+	if reason == "" || reason == defaultDeprecationReason {
+		return " @deprecated"
+	}
+	return fmt.Sprintf(" @deprecated(reason: %s)", printString(reason))
+}
+
+// printDescription prints a description on its own lines, as a block string
+// when it spans several lines.
+func printDescription(description string, indent string) string {
+	if description == "" {
+		return ""
+	}
+	if !strings.Contains(description, "\n") {
+		return indent + printString(description) + "\n"
+	}
+	lines := strings.Split(strings.ReplaceAll(description, `"""`, `\"""`), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return fmt.Sprintf("%s\"\"\"\n%s\n%s\"\"\"\n", indent, strings.Join(lines, "\n"), indent)
+}
+
+// printString quotes s as a graphql string, whose escapes are those of json
+// without the html escapes graphql does not know.
+func printString(s string) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
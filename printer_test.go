@@ -0,0 +1,130 @@
+package dgql_test
+
+import (
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/stretchr/testify/assert"
+)
+
+var printedSDL = `schema {
+  query: RootQuery
+}
+
+"""
+Requires the caller
+to have a role
+"""
+directive @auth(role: String = "admin") repeatable on FIELD_DEFINITION | OBJECT
+
+scalar Date
+
+interface Node {
+  id: ID!
+}
+
+"A product, <b>price</b> & name"
+type Product implements Node {
+  id: ID!
+  name(
+    "language code"
+    lang: String = "en"
+  ): String @deprecated(reason: "use title")
+  status: Status
+}
+
+input ProductInput {
+  title: String = "x\n\"y\""
+  ids: [[ID!]]!
+}
+
+type RootQuery {
+  node(id: ID!): Node
+  search(first: Int = 10, after: String): [SearchResult!]!
+}
+
+union SearchResult = Product
+
+enum Status {
+  ACTIVE
+  RETIRED @deprecated
+}
+`
+
+func TestSDL(t *testing.T) {
+	schema, err := dgql.ParseSDL(`
+type RootQuery { node(id: ID!): Node search(first: Int = 10, after: String): [SearchResult!]! }
+union SearchResult = Product
+enum Status { ACTIVE RETIRED @deprecated }
+input ProductInput { title: String = "x\n\"y\"" ids: [[ID!]]! }
+"A product, <b>price</b> & name"
+type Product implements Node {
+  id: ID!
+  name("language code" lang: String = "en"): String @deprecated(reason: "use title")
+  status: Status
+}
+interface Node { id: ID! }
+scalar Date
+"""
+Requires the caller
+to have a role
+"""
+directive @auth(role: String = "admin") repeatable on FIELD_DEFINITION | OBJECT
+schema { query: RootQuery }
+`)
+	if !assert.NoError(t, err, "Error parsing schema") {
+		return
+	}
+	assert.Equal(t, printedSDL, schema.SDL())
+	reparsed, err := dgql.ParseSDL(schema.SDL())
+	if assert.NoError(t, err, "Error parsing printed schema") {
+		assert.Equal(t, printedSDL, reparsed.SDL())
+	}
+}
+
+func TestIntrospectionSDL(t *testing.T) {
+	server := newTestServer(t, newRecursiveSchema(t))
+	introspection, err := dgql.Introspect(server.URL)
+	if !assert.NoError(t, err, "Error introspecting") {
+		return
+	}
+	// builtin scalars, directives and introspection types are left out
+	assert.Equal(t, `type Post {
+  author: User
+  tags: [Tag]
+  title: String
+}
+
+type Query {
+  me: User
+}
+
+type Tag {
+  label: String
+}
+
+type User {
+  friends: [User]
+  name: String
+  posts: [Post]
+}
+`, introspection.Schema.SDL())
+}
+
+func TestSDLDirectives(t *testing.T) {
+	sdl := `scalar DateTime @specifiedBy(url: "https://scalars.graphql.org/andimarek/date-time")
+
+input Lookup @oneOf {
+  id: ID
+  slug: String @deprecated
+}
+
+type Query {
+  item(lookup: Lookup!, legacyId: ID @deprecated(reason: "use lookup")): String
+}
+`
+	schema, err := dgql.ParseSDL(sdl)
+	if assert.NoError(t, err, "Error parsing schema") {
+		assert.Equal(t, sdl, schema.SDL())
+	}
+}
@@ -0,0 +1,183 @@
+package dgql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshCooldown is the minimum time between two refreshes started by
+// errors, so a field missing for good does not cause an introspection query
+// with every call.
+const refreshCooldown = 10 * time.Second
+
+// Fingerprint identifies the schema by a hash of its SDL, two introspections
+// of the same schema have the same fingerprint.
+func (s *IntrospectionSchema) Fingerprint() string {
+	sum := sha256.Sum256([]byte(s.SDL()))
+	return hex.EncodeToString(sum[:])
+}
+
+// SchemaChange is passed to the handler of WithSchemaChangeHandler when a
+// refresh found a schema with a different fingerprint.
+type SchemaChange struct {
+	Previous            *Introspection
+	Current             *Introspection
+	PreviousFingerprint string
+	Fingerprint         string
+}
+
+// schemaState is the schema of a client together with the documents
+// generated from it, it is replaced as a whole when the schema changes.
+type schemaState struct {
+	introspection           *Introspection
+	fingerprint             string
+	schema                  *Schema
+	queryDocumentMap        map[string]string
+	mutationDocumentMap     map[string]string
+	subscriptionDocumentMap map[string]string
+}
+
+func newSchemaState(introspection *Introspection, maxDepth int) *schemaState {
+	schema := newSchema(introspection.Schema)
+	return &schemaState{
+		introspection:           introspection,
+		fingerprint:             introspection.Schema.Fingerprint(),
+		schema:                  schema,
+		queryDocumentMap:        schema.parseOperations(OperationQuery, maxDepth),
+		mutationDocumentMap:     schema.parseOperations(OperationMutation, maxDepth),
+		subscriptionDocumentMap: schema.parseOperations(OperationSubscription, maxDepth),
+	}
+}
+
+// refresher re-introspects the schema of a client, periodically when
+// WithSchemaRefresh is set and on demand.
+type refresher struct {
+	options *options
+	// mu serializes refreshes
+	mu sync.Mutex
+	// last is the time the last refresh started by an error finished
+	last time.Time
+	stop chan struct{}
+	once sync.Once
+}
+
+// Fingerprint returns the fingerprint of the schema the client currently
+// generates documents from.
+func (c *GraphqlClient) Fingerprint() string {
+	return c.state.Load().fingerprint
+}
+
+// Introspection returns the schema the client currently generates documents
+// from.
+func (c *GraphqlClient) Introspection() *Introspection {
+	return c.state.Load().introspection
+}
+
+// Refresh introspects the endpoint again and, when the schema changed,
+// replaces the generated documents and calls the handler of
+// WithSchemaChangeHandler. Calls in flight keep using the documents they
+// started with.
+func (c *GraphqlClient) Refresh(ctx context.Context) error {
+	c.refresher.mu.Lock()
+	change, err := c.refresh(ctx)
+	c.refresher.mu.Unlock()
+	c.notify(change)
+	return err
+}
+
+// refresh replaces the schema of the client when it changed and returns the
+// change, nil when the schema stayed the same. The caller holds
+// refresher.mu.
+func (c *GraphqlClient) refresh(ctx context.Context) (*SchemaChange, error) {
+	introspection, err := getIntrospection(ctx, c.Endpoint, c.refresher.options)
+	if err != nil {
+		return nil, err
+	}
+	previous := c.state.Load()
+	state := newSchemaState(introspection, c.maxDepth)
+	if state.fingerprint == previous.fingerprint {
+		return nil, nil
+	}
+	c.state.Store(state)
+	return &SchemaChange{
+		Previous:            previous.introspection,
+		Current:             introspection,
+		PreviousFingerprint: previous.fingerprint,
+		Fingerprint:         state.fingerprint,
+	}, nil
+}
+
+// notify calls the handler of WithSchemaChangeHandler with change. It is
+// called without holding refresher.mu, so the handler may refresh again.
+func (c *GraphqlClient) notify(change *SchemaChange) {
+	if handler := c.refresher.options.schemaChangeHandler; handler != nil && change != nil {
+		handler(*change)
+	}
+}
+
+// Close stops refreshing the schema in the background. The client can still
+// be used afterwards.
+func (c *GraphqlClient) Close() error {
+	c.refresher.once.Do(func() {
+		close(c.refresher.stop)
+	})
+	return nil
+}
+
+// refreshPeriodically refreshes the schema every interval until the client
+// is closed, failed refreshes keep the current schema.
+func (c *GraphqlClient) refreshPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Refresh(context.Background())
+		case <-c.refresher.stop:
+			return
+		}
+	}
+}
+
+// refreshOnError starts a refresh in the background when err tells that a
+// generated document no longer matches the schema of the server.
+func (c *GraphqlClient) refreshOnError(err error) {
+	if err == nil || !c.refresher.options.refreshOnValidationError || !isSchemaMismatch(err) {
+		return
+	}
+	go func() {
+		if !c.refresher.mu.TryLock() {
+			// a refresh is already running
+			return
+		}
+		if time.Since(c.refresher.last) < refreshCooldown {
+			c.refresher.mu.Unlock()
+			return
+		}
+		change, _ := c.refresh(context.Background())
+		c.refresher.last = time.Now()
+		c.refresher.mu.Unlock()
+		c.notify(change)
+	}()
+}
+
+// isSchemaMismatch reports whether err contains a validation error about a
+// field the server does not know.
+func isSchemaMismatch(err error) bool {
+	var errs GraphQLErrors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, e := range errs {
+		message := strings.ToLower(e.Message)
+		if strings.Contains(message, "cannot query field") || strings.Contains(message, "unknown field") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package dgql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sczlog/dgql"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+// newVersionedSchema returns a schema whose User has an age in version 1,
+// version 2 drops it and adds Query.version.
+func newVersionedSchema(t *testing.T, version int) graphql.Schema {
+	userFields := graphql.Fields{
+		"name": &graphql.Field{Type: graphql.String},
+	}
+	queryFields := graphql.Fields{}
+	if version == 1 {
+		userFields["age"] = &graphql.Field{Type: graphql.Int}
+	} else {
+		queryFields["version"] = &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return "v2", nil
+			},
+		}
+	}
+	queryFields["me"] = &graphql.Field{
+		Type: graphql.NewObject(graphql.ObjectConfig{Name: "User", Fields: userFields}),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return map[string]interface{}{"name": "dgql", "age": 1}, nil
+		},
+	}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queryFields}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// newSwappableServer serves the first schema until swap is called.
+func newSwappableServer(t *testing.T, first graphql.Schema, second graphql.Schema) (*httptest.Server, func()) {
+	var handler atomic.Value
+	handler.Store(newTestHandler(first))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.Load().(http.Handler).ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() {
+		handler.Store(newTestHandler(second))
+	}
+}
+
+func waitForChange(t *testing.T, changes <-chan dgql.SchemaChange) (dgql.SchemaChange, bool) {
+	select {
+	case change := <-changes:
+		return change, true
+	case <-time.After(5 * time.Second):
+		t.Error("schema was not refreshed")
+		return dgql.SchemaChange{}, false
+	}
+}
+
+func TestSchemaRefresh(t *testing.T) {
+	server, swap := newSwappableServer(t, newVersionedSchema(t, 1), newVersionedSchema(t, 2))
+	changes := make(chan dgql.SchemaChange, 1)
+	client, err := dgql.NewClient(server.URL,
+		dgql.WithSchemaRefresh(20*time.Millisecond),
+		dgql.WithSchemaChangeHandler(func(change dgql.SchemaChange) {
+			changes <- change
+		}),
+	)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	defer client.Close()
+	fingerprint := client.Fingerprint()
+	_, _, err = client.Document(dgql.OperationQuery, "version")
+	assert.EqualError(t, err, "query version not found")
+
+	swap()
+	change, ok := waitForChange(t, changes)
+	if !ok {
+		return
+	}
+	assert.Equal(t, fingerprint, change.PreviousFingerprint)
+	assert.Equal(t, client.Fingerprint(), change.Fingerprint)
+	assert.NotEqual(t, fingerprint, change.Fingerprint)
+	assert.Equal(t, change.Current, client.Introspection())
+	resp, _, err := client.Query(context.Background(), "version", nil, nil)
+	if assert.NoError(t, err, "Error querying") {
+		assert.Equal(t, "v2", resp.Get("version").String())
+	}
+}
+
+func TestRefreshOnValidationError(t *testing.T) {
+	server, swap := newSwappableServer(t, newVersionedSchema(t, 1), newVersionedSchema(t, 2))
+	changes := make(chan dgql.SchemaChange, 1)
+	client, err := dgql.NewClient(server.URL,
+		dgql.WithRefreshOnValidationError(),
+		dgql.WithSchemaChangeHandler(func(change dgql.SchemaChange) {
+			changes <- change
+		}),
+	)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	swap()
+	_, _, err = client.Query(context.Background(), "me", nil, nil)
+	var errs dgql.GraphQLErrors
+	if !assert.ErrorAs(t, err, &errs) {
+		return
+	}
+	if _, ok := waitForChange(t, changes); !ok {
+		return
+	}
+	resp, _, err := client.Query(context.Background(), "me", nil, nil)
+	if assert.NoError(t, err, "Error querying") {
+		assert.Equal(t, `{"me":{"name":"dgql"}}`, resp.Raw)
+	}
+}
+
+func TestRefreshFromSchemaChangeHandler(t *testing.T) {
+	server, swap := newSwappableServer(t, newVersionedSchema(t, 1), newVersionedSchema(t, 2))
+	var client *dgql.GraphqlClient
+	refreshed := make(chan error, 1)
+	client, err := dgql.NewClient(server.URL,
+		dgql.WithSchemaChangeHandler(func(change dgql.SchemaChange) {
+			// the handler is called after the refresh released its lock
+			refreshed <- client.Refresh(context.Background())
+		}),
+	)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	swap()
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Refresh(context.Background())
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err, "Error refreshing")
+		assert.NoError(t, <-refreshed, "Error refreshing from the handler")
+	case <-time.After(5 * time.Second):
+		t.Error("Refresh deadlocked")
+	}
+}
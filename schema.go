@@ -3,51 +3,141 @@ package dgql
 import (
 	"fmt"
 	"strings"
-
-	"github.com/go-resty/resty/v2"
 )
 
-type RetrieveType struct {
-	Name      string
-	Kind      string
-	IsList    bool
-	IsNonNull bool
+// TypeRef is a reference to a named type wrapped in any number of LIST and
+// NON_NULL modifiers, e.g. [[Int!]]! is NON_NULL(LIST(LIST(NON_NULL(Int)))).
+type TypeRef struct {
+	Kind   string
+	Name   string
+	OfType *TypeRef
 }
 
-var objectTypeMap = make(map[string]*ObjectDefinition)
+func (t *IntrospectionTypeRef) typeRef() *TypeRef {
+	result := &TypeRef{
+		Kind: t.Kind,
+		Name: t.Name,
+	}
+	if t.OfType != nil {
+		result.OfType = t.OfType.typeRef()
+	}
+	return result
+}
+
+func (t *IntrospectionOfType) typeRef() *TypeRef {
+	result := &TypeRef{
+		Kind: t.Kind,
+		Name: t.Name,
+	}
+	if t.OfType != nil {
+		result.OfType = t.OfType.typeRef()
+	}
+	return result
+}
 
-func (t IntrospectionOfType) retrieveType(parent *RetrieveType) *RetrieveType {
-	if parent == nil {
-		parent = &RetrieveType{}
+// Named unwraps all LIST and NON_NULL modifiers and returns the named type.
+func (t *TypeRef) Named() *TypeRef {
+	if (t.Kind == "LIST" || t.Kind == "NON_NULL") && t.OfType != nil {
+		return t.OfType.Named()
 	}
-	if t.Kind == "LIST" {
-		parent.IsList = true
-		return t.OfType.retrieveType(parent)
-	} else if t.Kind == "NON_NULL" {
-		parent.IsNonNull = true
-		return t.OfType.retrieveType(parent)
+	return t
+}
+
+func (t *TypeRef) IsNonNull() bool {
+	return t.Kind == "NON_NULL"
+}
+
+func (t *TypeRef) IsList() bool {
+	if t.Kind == "NON_NULL" && t.OfType != nil {
+		return t.OfType.IsList()
 	}
-	parent.Name = t.Name
-	parent.Kind = t.Kind
-	return parent
+	return t.Kind == "LIST"
 }
 
-func (t RetrieveType) toArgString() string {
-	if t.IsNonNull {
-		return fmt.Sprintf("%s!", t.Name)
+// String renders the type as it is written in a graphql document. Wrappers
+// whose type was cut off by the introspection render without it.
+func (t *TypeRef) String() string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind {
+	case "NON_NULL":
+		return fmt.Sprintf("%s!", t.OfType.String())
+	case "LIST":
+		return fmt.Sprintf("[%s]", t.OfType.String())
 	}
 	return t.Name
 }
 
+// Schema is the type registry of a single graphql service. It is built once
+// from an introspection result and never modified afterwards, so it can be
+// shared by concurrent requests.
+type Schema struct {
+	objects map[string]*ObjectDefinition
+	// inputObjects maps the name of an input object type to its fields.
+	inputObjects map[string][]*ArgumentDefinition
+	// roots maps an operation type to the name of its root object type.
+	roots map[string]string
+}
+
+const (
+	OperationQuery        = "query"
+	OperationMutation     = "mutation"
+	OperationSubscription = "subscription"
+)
+
+// DefaultMaxDepth is the number of nested selection sets generated for an
+// operation unless configured otherwise, e.g. product { id owner { name } }.
+const DefaultMaxDepth = 2
+
+func newSchema(i *IntrospectionSchema) *Schema {
+	var objects = make(map[string]*ObjectDefinition)
+	var inputObjects = make(map[string][]*ArgumentDefinition)
+	for _, t := range i.Types {
+		switch t.Kind {
+		case "OBJECT", "INTERFACE", "UNION":
+			objects[t.Name] = t.parseObject()
+		case "INPUT_OBJECT":
+			fields := make([]*ArgumentDefinition, len(t.InputFields))
+			for idx, field := range t.InputFields {
+				fields[idx] = &ArgumentDefinition{
+					Name: field.Name,
+					Type: field.Type.typeRef(),
+				}
+			}
+			inputObjects[t.Name] = fields
+		}
+	}
+	queryName, mutationName, subscriptionName := i.rootTypeNames()
+	return &Schema{
+		objects:      objects,
+		inputObjects: inputObjects,
+		roots: map[string]string{
+			OperationQuery:        queryName,
+			OperationMutation:     mutationName,
+			OperationSubscription: subscriptionName,
+		},
+	}
+}
+
+// ObjectDefinition describes an object, interface or union type. Interfaces
+// and unions list the names of the object types they may resolve to.
 type ObjectDefinition struct {
-	Name   string
-	Kind   string
-	Fields []*ObjectFieldDefinition
+	Name          string
+	Kind          string
+	Fields        []*ObjectFieldDefinition
+	PossibleTypes []string
 }
 
 type ObjectFieldDefinition struct {
 	Name string
-	Type *RetrieveType
+	Args []*ArgumentDefinition
+	Type *TypeRef
+}
+
+type ArgumentDefinition struct {
+	Name string
+	Type *TypeRef
 }
 
 func (t IntrospectionType) parseObject() *ObjectDefinition {
@@ -55,6 +145,9 @@ func (t IntrospectionType) parseObject() *ObjectDefinition {
 		Name: t.Name,
 		Kind: t.Kind,
 	}
+	for _, possibleType := range t.PossibleTypes {
+		result.PossibleTypes = append(result.PossibleTypes, possibleType.Name)
+	}
 	if t.Fields != nil && len(t.Fields) > 0 {
 		var fields = make([]*ObjectFieldDefinition, 0)
 		for _, field := range t.Fields {
@@ -63,22 +156,17 @@ func (t IntrospectionType) parseObject() *ObjectDefinition {
 				continue
 			}
 			if field.Type != nil {
-				var typeName *RetrieveType
-				if field.Type.OfType != nil {
-					typeName = &RetrieveType{
-						IsList:    field.Type.Kind == "LIST",
-						IsNonNull: field.Type.Kind == "NON_NULL",
-					}
-					typeName = field.Type.OfType.retrieveType(typeName)
-				} else {
-					typeName = &RetrieveType{
-						Name: field.Type.Name,
-						Kind: field.Type.Kind,
-					}
+				var args = make([]*ArgumentDefinition, 0, len(field.Args))
+				for _, arg := range field.Args {
+					args = append(args, &ArgumentDefinition{
+						Name: arg.Name,
+						Type: arg.Type.typeRef(),
+					})
 				}
 				fields = append(fields, &ObjectFieldDefinition{
 					Name: field.Name,
-					Type: typeName,
+					Args: args,
+					Type: field.Type.typeRef(),
 				})
 			}
 		}
@@ -87,151 +175,492 @@ func (t IntrospectionType) parseObject() *ObjectDefinition {
 	return &result
 }
 
-func (o ObjectDefinition) parseObjectOutput(nested bool) string {
-	fields := make([]string, 0)
-	for _, field := range o.Fields {
-		switch field.Type.Kind {
-		case "SCALAR":
-			fallthrough
-		case "ENUM":
-			fields = append(fields, field.Name)
-		case "OBJECT":
-			if !nested {
-				typeDef := objectTypeMap[field.Type.Name]
-				if typeDef != nil {
-					nestedQuery := typeDef.parseObjectOutput(true)
-					fields = append(fields, fmt.Sprintf("%s %s ", field.Name, nestedQuery))
-				} else {
-					panic(fmt.Sprintf("Object %s not found", field.Type.Name))
-				}
+// selectionBuilder expands output types into selection sets, it stops at
+// maxDepth nested selection sets and at types that are already being expanded
+// further up the path, recording every field it had to leave out.
+type selectionBuilder struct {
+	schema    *Schema
+	maxDepth  int
+	exclude   map[string]bool
+	truncated []string
+}
+
+// fieldTree is a set of dotted field paths, e.g. id and owner.name, grouped
+// by their leading field name.
+type fieldTree map[string]fieldTree
+
+func newFieldTree(paths []string) fieldTree {
+	var tree = make(fieldTree)
+	for _, path := range paths {
+		node := tree
+		for _, name := range strings.Split(path, ".") {
+			if node[name] == nil {
+				node[name] = make(fieldTree)
 			}
+			node = node[name]
 		}
 	}
-	return fmt.Sprintf("{ %s }", strings.Join(fields, " "))
+	return tree
 }
 
-func (t IntrospectionTypeRef) parseOutputType() string {
-	var typeName *RetrieveType
-	if t.OfType != nil {
-		typeName = &RetrieveType{
-			IsList:    t.Kind == "LIST",
-			IsNonNull: t.Kind == "NON_NULL",
-		}
-		typeName = t.OfType.retrieveType(typeName)
-	} else {
-		typeName = &RetrieveType{
-			Name: t.Name,
-			Kind: t.Kind,
-		}
-	}
-	switch typeName.Kind {
+// selection returns the selection set of t, or an empty string when t is a
+// leaf type. path is the dotted path of the field whose type is t. When
+// include is not empty only the fields it names are selected, otherwise
+// every field that is not excluded is expanded.
+func (b *selectionBuilder) selection(t *TypeRef, path string, depth int, ancestors []string, include fieldTree) (string, error) {
+	named := t.Named()
+	switch named.Kind {
 	// for scalar type, no nest query is needed
 	case "SCALAR":
 		fallthrough
 	case "ENUM":
-		return ""
+		if len(include) > 0 {
+			return "", fmt.Errorf("field %s has no subfields", path)
+		}
+		return "", nil
 	case "OBJECT":
-		typeDef := objectTypeMap[typeName.Name]
-		if typeDef != nil {
-			return typeDef.parseObjectOutput(false)
-		} else {
-			panic(fmt.Sprintf("Object %s not found", typeName.Name))
+		typeDef := b.schema.objects[named.Name]
+		if typeDef == nil {
+			return "", fmt.Errorf("object %s not found", named.Name)
+		}
+		if len(include) > 0 {
+			return b.includedSelection(typeDef, path, depth, ancestors, include)
 		}
+		return b.objectSelection(typeDef, path, depth, ancestors)
+	case "INTERFACE":
+		fallthrough
+	case "UNION":
+		typeDef := b.schema.objects[named.Name]
+		if typeDef == nil {
+			return "", fmt.Errorf("%s %s not found", strings.ToLower(named.Kind), named.Name)
+		}
+		return b.abstractSelection(typeDef, path, depth, ancestors, include)
 	}
-	panic(fmt.Sprintf("Unknown type %s", typeName.Name))
+	return "", fmt.Errorf("unknown type %s", named.Name)
+}
+
+// selectedField is a field of a selection set together with the selection
+// set of its own type, which is empty for leaf types.
+type selectedField struct {
+	alias     string
+	name      string
+	fieldType *TypeRef
+	selection string
 }
 
-func (i *Introspection) ParseSchema() *GraphqlClient {
-	var mutationDocumentMap = make(map[string]string)
-	var queryDocumentMap = make(map[string]string)
-	var query *IntrospectionType
-	var mutation *IntrospectionType
-	for _, t := range i.Schema.Types {
-		if t.Kind == "OBJECT" {
-			if t.Name == "Query" {
-				query = t
-			} else if t.Name == "Mutation" {
-				mutation = t
+func (f selectedField) String() string {
+	result := f.name
+	if f.alias != "" {
+		result = fmt.Sprintf("%s: %s", f.alias, f.name)
+	}
+	if f.selection != "" {
+		result = fmt.Sprintf("%s %s", result, f.selection)
+	}
+	return result
+}
+
+func printSelection(fields []selectedField) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	selections := make([]string, len(fields))
+	for i, field := range fields {
+		selections[i] = field.String()
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(selections, " "))
+}
+
+// objectSelection expands every field of an object that is not excluded.
+func (b *selectionBuilder) objectSelection(typeDef *ObjectDefinition, path string, depth int, ancestors []string) (string, error) {
+	fields, err := b.objectFields(typeDef, path, depth, ancestors, nil)
+	if err != nil {
+		return "", err
+	}
+	return printSelection(fields), nil
+}
+
+// objectFields expands every field of an object that is neither excluded nor
+// named by skip.
+func (b *selectionBuilder) objectFields(typeDef *ObjectDefinition, path string, depth int, ancestors []string, skip []string) ([]selectedField, error) {
+	ancestors = append(ancestors, typeDef.Name)
+	fields := make([]selectedField, 0)
+	for _, field := range typeDef.Fields {
+		fieldPath := fmt.Sprintf("%s.%s", path, field.Name)
+		if b.exclude[fieldPath] || contains(skip, field.Name) {
+			continue
+		}
+		fieldType := field.Type.Named()
+		if fieldType.Kind == "SCALAR" || fieldType.Kind == "ENUM" {
+			fields = append(fields, selectedField{name: field.Name, fieldType: field.Type})
+			continue
+		}
+		if depth >= b.maxDepth || contains(ancestors, fieldType.Name) {
+			b.truncate(fieldPath)
+			continue
+		}
+		nestedQuery, err := b.selection(field.Type, fieldPath, depth+1, ancestors, nil)
+		if err != nil {
+			return nil, err
+		}
+		if nestedQuery == "" {
+			b.truncate(fieldPath)
+			continue
+		}
+		fields = append(fields, selectedField{name: field.Name, fieldType: field.Type, selection: nestedQuery})
+	}
+	return fields, nil
+}
+
+// fragment is an inline fragment on a possible type of an interface or union.
+type fragment struct {
+	typeName string
+	fields   []selectedField
+}
+
+// abstractSelection selects __typename, the fields of an interface and an
+// inline fragment with the remaining fields of every possible type. With
+// include, fragments are only generated for the possible types that have all
+// the included fields the interface lacks. A field whose type differs
+// between fragments is aliased as Type_field in each of them, as the
+// fragments could not be merged otherwise.
+func (b *selectionBuilder) abstractSelection(typeDef *ObjectDefinition, path string, depth int, ancestors []string, include fieldTree) (string, error) {
+	// the interface's own fields are selected once for all possible types
+	var shared []selectedField
+	var err error
+	sharedNames := make([]string, len(typeDef.Fields))
+	for i, field := range typeDef.Fields {
+		sharedNames[i] = field.Name
+	}
+	fragmentInclude := include
+	if len(include) > 0 {
+		sharedInclude := make(fieldTree)
+		fragmentInclude = make(fieldTree)
+		for name, children := range include {
+			if contains(sharedNames, name) {
+				sharedInclude[name] = children
 			} else {
-				objectTypeMap[t.Name] = t.parseObject()
+				fragmentInclude[name] = children
 			}
-		} else if t.Kind == "UNION" {
-			//TODO: add support for union
-		}
-	}
-	for _, query := range query.Fields {
-		name := query.Name
-		var argsStr string
-		var resolverStr string
-		if query.Args != nil && len(query.Args) > 0 {
-			args := make([]string, len(query.Args))
-			args2 := make([]string, len(query.Args))
-			for idx, arg := range query.Args {
-				var typeName *RetrieveType
-				if arg.Type.OfType != nil {
-					typeName = &RetrieveType{
-						IsList:    arg.Type.Kind == "LIST",
-						IsNonNull: arg.Type.Kind == "NON_NULL",
-					}
-					typeName = arg.Type.OfType.retrieveType(typeName)
-				} else {
-					typeName = &RetrieveType{
-						Name: arg.Type.Name,
-						Kind: arg.Type.Kind,
-					}
+		}
+		if len(sharedInclude) > 0 {
+			shared, err = b.includedFields(typeDef, path, depth, ancestors, sharedInclude)
+		}
+	} else {
+		shared, err = b.objectFields(typeDef, path, depth, ancestors, nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	ancestors = append(ancestors, typeDef.Name)
+	fragments := make([]fragment, 0)
+	var includeErr error
+	for _, name := range typeDef.PossibleTypes {
+		if len(include) > 0 && len(fragmentInclude) == 0 {
+			break
+		}
+		possibleType := b.schema.objects[name]
+		if possibleType == nil {
+			return "", fmt.Errorf("object %s not found", name)
+		}
+		var fields []selectedField
+		if len(include) > 0 {
+			fields, err = b.includedFields(possibleType, path, depth, ancestors, fragmentInclude)
+			if err != nil {
+				if includeErr == nil {
+					includeErr = err
 				}
-				args[idx] = fmt.Sprintf("$%s: %s", arg.Name, typeName.toArgString())
-				args2[idx] = fmt.Sprintf("%s: $%s", arg.Name, arg.Name)
+				continue
 			}
-			argsStr = fmt.Sprintf("(%s)", strings.Join(args, ", "))
-			resolverStr = fmt.Sprintf("(%s)", strings.Join(args2, ", "))
 		} else {
-			// resolver with no args
-			argsStr = ""
-			resolverStr = ""
-		}
-		output := query.Type.parseOutputType()
-		queryDocumentMap[name] = fmt.Sprintf("query %s%s { %s%s %s}", name, argsStr, name, resolverStr, output)
-	}
-	for _, mutation := range mutation.Fields {
-		name := mutation.Name
-		var argsStr string
-		var resolverStr string
-		if mutation.Args != nil && len(mutation.Args) > 0 {
-			args := make([]string, len(mutation.Args))
-			args2 := make([]string, len(mutation.Args))
-			for idx, arg := range mutation.Args {
-				var typeName *RetrieveType
-				if arg.Type.OfType != nil {
-					typeName = &RetrieveType{
-						IsList:    arg.Type.Kind == "LIST",
-						IsNonNull: arg.Type.Kind == "NON_NULL",
-					}
-					typeName = arg.Type.OfType.retrieveType(typeName)
-				} else {
-					typeName = &RetrieveType{
-						Name: arg.Type.Name,
-						Kind: arg.Type.Kind,
-					}
-				}
-				args[idx] = fmt.Sprintf("$%s: %s", arg.Name, typeName.toArgString())
-				args2[idx] = fmt.Sprintf("%s: $%s", arg.Name, arg.Name)
+			fields, err = b.objectFields(possibleType, path, depth, ancestors, sharedNames)
+			if err != nil {
+				return "", err
+			}
+		}
+		if len(fields) > 0 {
+			fragments = append(fragments, fragment{typeName: name, fields: fields})
+		}
+	}
+	if len(fragments) == 0 && len(fragmentInclude) > 0 && includeErr != nil {
+		return "", includeErr
+	}
+	aliasConflicts(fragments)
+	selections := []string{"__typename"}
+	for _, field := range shared {
+		selections = append(selections, field.String())
+	}
+	for _, f := range fragments {
+		selections = append(selections, fmt.Sprintf("... on %s %s", f.typeName, printSelection(f.fields)))
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(selections, " ")), nil
+}
+
+// aliasConflicts aliases the fields selected with different types in
+// different fragments, e.g. value as A_value: value and B_value: value.
+func aliasConflicts(fragments []fragment) {
+	types := make(map[string]string)
+	conflicts := make(map[string]bool)
+	for _, f := range fragments {
+		for _, field := range f.fields {
+			fieldType := field.fieldType.String()
+			if previous, ok := types[field.name]; ok && previous != fieldType {
+				conflicts[field.name] = true
+			}
+			types[field.name] = fieldType
+		}
+	}
+	for _, f := range fragments {
+		for i, field := range f.fields {
+			if conflicts[field.name] {
+				f.fields[i].alias = fmt.Sprintf("%s_%s", f.typeName, field.name)
+			}
+		}
+	}
+}
+
+// truncate records a left out field once, fields of interfaces and unions
+// are visited once per possible type.
+func (b *selectionBuilder) truncate(path string) {
+	if !contains(b.truncated, path) {
+		b.truncated = append(b.truncated, path)
+	}
+}
+
+// includedSelection selects the fields named by include in schema order.
+// Object fields without subpaths are expanded like any other field, but even
+// past the max depth since they were asked for explicitly.
+func (b *selectionBuilder) includedSelection(typeDef *ObjectDefinition, path string, depth int, ancestors []string, include fieldTree) (string, error) {
+	fields, err := b.includedFields(typeDef, path, depth, ancestors, include)
+	if err != nil {
+		return "", err
+	}
+	return printSelection(fields), nil
+}
+
+func (b *selectionBuilder) includedFields(typeDef *ObjectDefinition, path string, depth int, ancestors []string, include fieldTree) ([]selectedField, error) {
+	ancestors = append(ancestors, typeDef.Name)
+	fields := make([]selectedField, 0)
+	found := 0
+	for _, field := range typeDef.Fields {
+		children, ok := include[field.Name]
+		if !ok {
+			continue
+		}
+		found++
+		fieldPath := fmt.Sprintf("%s.%s", path, field.Name)
+		nestedQuery, err := b.selection(field.Type, fieldPath, depth+1, ancestors, children)
+		if err != nil {
+			return nil, err
+		}
+		if nestedQuery == "" {
+			kind := field.Type.Named().Kind
+			if kind != "SCALAR" && kind != "ENUM" {
+				return nil, fmt.Errorf("field %s has no selectable fields", fieldPath)
+			}
+		}
+		fields = append(fields, selectedField{name: field.Name, fieldType: field.Type, selection: nestedQuery})
+	}
+	if found < len(include) {
+		for name := range include {
+			if typeDef.field(name) == nil {
+				return nil, fmt.Errorf("field %s.%s not found", path, name)
 			}
-			argsStr = fmt.Sprintf("(%s)", strings.Join(args, ", "))
-			resolverStr = fmt.Sprintf("(%s)", strings.Join(args2, ", "))
-		} else {
-			// resolver with no args
-			argsStr = ""
-			resolverStr = ""
 		}
-		output := mutation.Type.parseOutputType()
-		mutationDocumentMap[name] = fmt.Sprintf("mutation %s%s { %s%s %s}", name, argsStr, name, resolverStr, output)
 	}
-	return &GraphqlClient{
-		queryDocumentMap:    queryDocumentMap,
-		mutationDocumentMap: mutationDocumentMap,
-		DefaultHeaders:      make(map[string]string),
-		Endpoint:            i.Endpoint,
-		Client:              resty.New(),
+	return fields, nil
+}
+
+func (o *ObjectDefinition) field(name string) *ObjectFieldDefinition {
+	for _, field := range o.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// checkPath reports an error unless path names a field reachable from t.
+func (s *Schema) checkPath(t *TypeRef, path string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	named := t.Named()
+	typeDef := s.objects[named.Name]
+	if typeDef == nil {
+		return fmt.Errorf("field %s has no subfields", path)
+	}
+	field := typeDef.field(names[0])
+	if field == nil {
+		// fields of a union or of an interface implementation only exist on
+		// the possible types
+		for _, name := range typeDef.PossibleTypes {
+			possibleType := &TypeRef{Kind: "OBJECT", Name: name}
+			if s.checkPath(possibleType, path, names) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("field %s.%s not found", path, names[0])
+	}
+	return s.checkPath(field.Type, fmt.Sprintf("%s.%s", path, names[0]), names[1:])
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Document builds the document of an operation. Unless selected otherwise
+// with WithFields, object fields are expanded up to the max depth; the dotted
+// paths of the fields left out because of the limit or because they recurse
+// into an enclosing type are returned as truncated.
+func (s *Schema) Document(operation string, operationName string, opts ...CallOption) (document string, truncated []string, err error) {
+	var callOptions = newCallOptions(opts)
+	maxDepth := callOptions.maxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if maxDepth < 1 {
+		return "", nil, fmt.Errorf("invalid max depth %d", maxDepth)
+	}
+	var root *ObjectDefinition
+	if name := s.roots[operation]; name != "" {
+		root = s.objects[name]
+	}
+	var field *ObjectFieldDefinition
+	if root != nil {
+		field = root.field(operationName)
+	}
+	if field == nil {
+		return "", nil, fmt.Errorf("%s %s not found", operation, operationName)
+	}
+	var argsStr string
+	var resolverStr string
+	if len(field.Args) > 0 {
+		args := make([]string, len(field.Args))
+		args2 := make([]string, len(field.Args))
+		for idx, arg := range field.Args {
+			args[idx] = fmt.Sprintf("$%s: %s", arg.Name, arg.Type)
+			args2[idx] = fmt.Sprintf("%s: $%s", arg.Name, arg.Name)
+		}
+		argsStr = fmt.Sprintf("(%s)", strings.Join(args, ", "))
+		resolverStr = fmt.Sprintf("(%s)", strings.Join(args2, ", "))
+	}
+	builder := &selectionBuilder{
+		schema:   s,
+		maxDepth: maxDepth,
+		exclude:  make(map[string]bool),
+	}
+	for _, path := range callOptions.exclude {
+		if err := s.checkPath(field.Type, operationName, strings.Split(path, ".")); err != nil {
+			return "", nil, err
+		}
+		builder.exclude[fmt.Sprintf("%s.%s", operationName, path)] = true
+	}
+	output, err := builder.selection(field.Type, field.Name, 1, nil, newFieldTree(callOptions.include))
+	if err != nil {
+		return "", nil, err
+	}
+	if output == "" && field.Type.Named().Kind != "SCALAR" && field.Type.Named().Kind != "ENUM" {
+		return "", nil, fmt.Errorf("%s %s has no selectable fields", operation, operationName)
+	}
+	if output != "" {
+		output = " " + output
+	}
+	document = fmt.Sprintf("%s %s%s { %s%s%s }", operation, operationName, argsStr, operationName, resolverStr, output)
+	return document, builder.truncated, nil
+}
+
+// rootTypeNames returns the names of the query, mutation and subscription root
+// types declared by the schema, an empty name means the root is absent.
+// Introspection results without root type information fall back to the
+// conventional Query/Mutation/Subscription names.
+func (s *IntrospectionSchema) rootTypeNames() (string, string, string) {
+	if s.QueryType == nil && s.MutationType == nil && s.SubscriptionType == nil {
+		return "Query", "Mutation", "Subscription"
+	}
+	var query, mutation, subscription string
+	if s.QueryType != nil {
+		query = s.QueryType.Name
+	}
+	if s.MutationType != nil {
+		mutation = s.MutationType.Name
+	}
+	if s.SubscriptionType != nil {
+		subscription = s.SubscriptionType.Name
+	}
+	return query, mutation, subscription
+}
+
+// parseOperations builds a document for every field of the operation's
+// root type. Operations whose document can not be built are left out, the
+// error is reported again when the operation is requested.
+func (s *Schema) parseOperations(operation string, maxDepth int) map[string]string {
+	var documentMap = make(map[string]string)
+	root := s.objects[s.roots[operation]]
+	if root == nil {
+		return documentMap
+	}
+	for _, field := range root.Fields {
+		document, _, err := s.Document(operation, field.Name, WithDepth(maxDepth))
+		if err == nil {
+			documentMap[field.Name] = document
+		}
+	}
+	return documentMap
+}
+
+// ParseSchema builds a client from the introspection. It panics when the
+// options are invalid, e.g. a max depth below 1, NewClientFromIntrospection
+// returns the error instead.
+func (i *Introspection) ParseSchema(opts ...Option) *GraphqlClient {
+	client, err := i.parseSchema(newOptions(opts))
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// NewClientFromIntrospection builds a client from an introspection result,
+// e.g. one loaded with LoadIntrospection.
+func NewClientFromIntrospection(i *Introspection, opts ...Option) (*GraphqlClient, error) {
+	return i.parseSchema(newOptions(opts))
+}
+
+func (i *Introspection) parseSchema(options *options) (*GraphqlClient, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	if err := i.Schema.checkTypeRefs(); err != nil {
+		return nil, err
+	}
+	client := &GraphqlClient{
+		refresher: &refresher{
+			options: options,
+			stop:    make(chan struct{}),
+		},
+		maxDepth:              options.maxDepth,
+		subscriptionTransport: options.subscriptionTransport,
+		reconnectAttempts:     options.reconnectAttempts,
+		reconnectDelay:        options.reconnectDelay,
+		getQueries:            options.getQueries,
+		maxURLLength:          options.maxURLLength,
+		DefaultHeaders:        options.headers,
+		Endpoint:              i.Endpoint,
+		Client:                options.client,
+	}
+	if options.cacheEntries > 0 {
+		client.cache = newHTTPCache(options.cacheEntries)
+	}
+	if options.persistedQueries {
+		client.persisted = &persistedQueries{}
+	}
+	client.state.Store(newSchemaState(i, options.maxDepth))
+	if options.refreshInterval > 0 {
+		go client.refreshPeriodically(options.refreshInterval)
 	}
+	return client, nil
 }
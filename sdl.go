@@ -0,0 +1,449 @@
+package dgql
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/lexer"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/printer"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// builtinScalars are available in every schema without being declared.
+var builtinScalars = []string{"Int", "Float", "String", "Boolean", "ID"}
+
+// ParseSDL builds the introspection result of a schema written in the
+// graphql schema definition language, so a client can be created without
+// introspecting the server. Only object type extensions, extend type, are
+// supported and merged into the extended types; extend input, enum, schema
+// and the like are syntax errors. Root types default to Query, Mutation and
+// Subscription unless a schema block declares them.
+func ParseSDL(sdl string) (*IntrospectionSchema, error) {
+	sdl, repeatable := stripRepeatable(sdl)
+	document, err := parser.Parse(parser.ParseParams{Source: sdl})
+	if err != nil {
+		return nil, err
+	}
+	builder := &sdlBuilder{
+		kinds:      make(map[string]string),
+		types:      make(map[string]*IntrospectionType),
+		repeatable: repeatable,
+	}
+	return builder.build(document)
+}
+
+// stripRepeatable blanks the repeatable keyword of directive definitions,
+// which the parser does not know yet, and returns the names of the
+// directives it was found on. Positions in parse errors stay the same.
+func stripRepeatable(sdl string) (string, map[string]bool) {
+	repeatable := make(map[string]bool)
+	runes := []rune(sdl)
+	lex := lexer.Lex(source.NewSource(&source.Source{Body: []byte(sdl)}))
+	var previous [2]lexer.Token
+	// directive is the definition being read, until its locations
+	var directive string
+	var depth int
+	var candidate *lexer.Token
+	for {
+		token, err := lex(0)
+		if err != nil || token.Kind == lexer.EOF {
+			break
+		}
+		if candidate != nil {
+			if token.Kind == lexer.NAME && token.Value == "on" {
+				for i := candidate.Start; i < candidate.End; i++ {
+					runes[i] = ' '
+				}
+				repeatable[directive] = true
+			}
+			candidate = nil
+		}
+		switch {
+		case token.Kind == lexer.NAME && previous[1].Kind == lexer.AT && previous[0].Kind == lexer.NAME && previous[0].Value == lexer.DIRECTIVE:
+			directive, depth = token.Value, 0
+		case directive == "":
+		case token.Kind == lexer.PAREN_L:
+			depth++
+		case token.Kind == lexer.PAREN_R:
+			depth--
+		case depth == 0 && token.Kind == lexer.NAME && token.Value == "repeatable":
+			candidate = &token
+		case depth == 0 && token.Kind == lexer.NAME && token.Value == "on":
+			directive = ""
+		}
+		previous[0], previous[1] = previous[1], token
+	}
+	if len(repeatable) == 0 {
+		return sdl, repeatable
+	}
+	return string(runes), repeatable
+}
+
+// NewClientFromSDL creates a client for endpoint from its schema document
+// instead of introspecting it.
+func NewClientFromSDL(endpoint string, sdl string, opts ...Option) (*GraphqlClient, error) {
+	schema, err := ParseSDL(sdl)
+	if err != nil {
+		return nil, err
+	}
+	introspection := &Introspection{
+		Schema:   schema,
+		Endpoint: endpoint,
+	}
+	return NewClientFromIntrospection(introspection, opts...)
+}
+
+// NewClientFromSDLFiles is NewClientFromSDL for a schema split across one or
+// more .graphql files.
+func NewClientFromSDLFiles(endpoint string, paths []string, opts ...Option) (*GraphqlClient, error) {
+	sources := make([]string, 0, len(paths))
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, string(source))
+	}
+	return NewClientFromSDL(endpoint, strings.Join(sources, "\n"), opts...)
+}
+
+type sdlBuilder struct {
+	// kinds maps every type name to its introspection kind
+	kinds map[string]string
+	types map[string]*IntrospectionType
+	order []string
+	// repeatable holds the names of the directives defined repeatable
+	repeatable map[string]bool
+}
+
+func (b *sdlBuilder) build(document *ast.Document) (*IntrospectionSchema, error) {
+	for _, name := range builtinScalars {
+		b.kinds[name] = "SCALAR"
+	}
+	// types may be referenced before they are defined, collect the kinds first
+	for _, definition := range document.Definitions {
+		var name *ast.Name
+		var kind string
+		switch definition := definition.(type) {
+		case *ast.ScalarDefinition:
+			name, kind = definition.Name, "SCALAR"
+		case *ast.ObjectDefinition:
+			name, kind = definition.Name, "OBJECT"
+		case *ast.InterfaceDefinition:
+			name, kind = definition.Name, "INTERFACE"
+		case *ast.UnionDefinition:
+			name, kind = definition.Name, "UNION"
+		case *ast.EnumDefinition:
+			name, kind = definition.Name, "ENUM"
+		case *ast.InputObjectDefinition:
+			name, kind = definition.Name, "INPUT_OBJECT"
+		default:
+			continue
+		}
+		if _, ok := b.types[name.Value]; ok {
+			return nil, fmt.Errorf("type %s is defined more than once", name.Value)
+		}
+		b.kinds[name.Value] = kind
+		b.types[name.Value] = &IntrospectionType{Kind: kind, Name: name.Value}
+		b.order = append(b.order, name.Value)
+	}
+	var schema = &IntrospectionSchema{}
+	var schemaDefinition *ast.SchemaDefinition
+	var extensions []*ast.ObjectDefinition
+	for _, definition := range document.Definitions {
+		var err error
+		switch definition := definition.(type) {
+		case *ast.SchemaDefinition:
+			schemaDefinition = definition
+		case *ast.TypeExtensionDefinition:
+			extensions = append(extensions, definition.Definition)
+		case *ast.DirectiveDefinition:
+			var directive *IntrospectionDirective
+			directive, err = b.directive(definition)
+			schema.Directives = append(schema.Directives, directive)
+		case *ast.ScalarDefinition:
+			t := b.types[definition.Name.Value]
+			t.Description = description(definition.Description)
+			if url, ok := directiveArgument(definition.Directives, "specifiedBy", "url").(string); ok {
+				t.SpecifiedByURL = url
+			}
+		case *ast.ObjectDefinition:
+			err = b.object(b.types[definition.Name.Value], definition)
+		case *ast.InterfaceDefinition:
+			t := b.types[definition.Name.Value]
+			t.Description = description(definition.Description)
+			t.Fields, err = b.fields(definition.Fields)
+		case *ast.UnionDefinition:
+			t := b.types[definition.Name.Value]
+			t.Description = description(definition.Description)
+			for _, member := range definition.Types {
+				var ref *IntrospectionTypeRef
+				ref, err = b.typeRef(member)
+				t.PossibleTypes = append(t.PossibleTypes, ref)
+			}
+		case *ast.EnumDefinition:
+			t := b.types[definition.Name.Value]
+			t.Description = description(definition.Description)
+			for _, value := range definition.Values {
+				isDeprecated, reason := deprecation(value.Directives)
+				t.EnumValues = append(t.EnumValues, &IntrospectionEnumValue{
+					Name:              value.Name.Value,
+					Description:       description(value.Description),
+					IsDeprecated:      isDeprecated,
+					DeprecationReason: reason,
+				})
+			}
+		case *ast.InputObjectDefinition:
+			t := b.types[definition.Name.Value]
+			t.Description = description(definition.Description)
+			t.IsOneOf = hasDirective(definition.Directives, "oneOf")
+			t.InputFields, err = b.inputValues(definition.Fields)
+		default:
+			err = fmt.Errorf("unexpected %s in schema document", definition.GetKind())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, extension := range extensions {
+		t := b.types[extension.Name.Value]
+		if t == nil || t.Kind != "OBJECT" {
+			return nil, fmt.Errorf("can not extend unknown type %s", extension.Name.Value)
+		}
+		if err := b.object(t, extension); err != nil {
+			return nil, err
+		}
+	}
+	// interfaces list the objects implementing them as possible types
+	for _, name := range b.order {
+		t := b.types[name]
+		for _, implemented := range t.Interfaces {
+			b.types[implemented.Name].PossibleTypes = append(b.types[implemented.Name].PossibleTypes, &IntrospectionTypeRef{
+				Kind: "OBJECT",
+				Name: t.Name,
+			})
+		}
+	}
+	for _, name := range b.order {
+		schema.Types = append(schema.Types, b.types[name])
+	}
+	for _, name := range builtinScalars {
+		if _, ok := b.types[name]; !ok {
+			schema.Types = append(schema.Types, &IntrospectionType{Kind: "SCALAR", Name: name})
+		}
+	}
+	if err := b.roots(schema, schemaDefinition); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// roots sets the root types declared by the schema block, or the ones named
+// after the operation types when there is none.
+func (b *sdlBuilder) roots(schema *IntrospectionSchema, definition *ast.SchemaDefinition) error {
+	roots := map[string]string{}
+	if definition != nil {
+		for _, operationType := range definition.OperationTypes {
+			roots[operationType.Operation] = operationType.Type.Name.Value
+		}
+	} else {
+		for operation, name := range map[string]string{
+			OperationQuery:        "Query",
+			OperationMutation:     "Mutation",
+			OperationSubscription: "Subscription",
+		} {
+			if b.kinds[name] == "OBJECT" {
+				roots[operation] = name
+			}
+		}
+	}
+	for operation, name := range roots {
+		if b.kinds[name] != "OBJECT" {
+			return fmt.Errorf("%s root type %s is not an object type", operation, name)
+		}
+		switch operation {
+		case OperationQuery:
+			schema.QueryType = &IntrospectionRootType{Name: name}
+		case OperationMutation:
+			schema.MutationType = &IntrospectionRootType{Name: name}
+		case OperationSubscription:
+			schema.SubscriptionType = &IntrospectionRootType{Name: name}
+		}
+	}
+	if schema.QueryType == nil {
+		return fmt.Errorf("schema has no query root type")
+	}
+	return nil
+}
+
+// object adds the fields and interfaces of an object definition or extension.
+func (b *sdlBuilder) object(t *IntrospectionType, definition *ast.ObjectDefinition) error {
+	if definition.Description != nil {
+		t.Description = description(definition.Description)
+	}
+	fields, err := b.fields(definition.Fields)
+	if err != nil {
+		return err
+	}
+	t.Fields = append(t.Fields, fields...)
+	for _, implemented := range definition.Interfaces {
+		if b.kinds[implemented.Name.Value] != "INTERFACE" {
+			return fmt.Errorf("%s implements unknown interface %s", t.Name, implemented.Name.Value)
+		}
+		ref, err := b.typeRef(implemented)
+		if err != nil {
+			return err
+		}
+		t.Interfaces = append(t.Interfaces, ref)
+	}
+	return nil
+}
+
+func (b *sdlBuilder) fields(definitions []*ast.FieldDefinition) ([]*IntrospectionField, error) {
+	fields := make([]*IntrospectionField, 0, len(definitions))
+	for _, definition := range definitions {
+		fieldType, err := b.typeRef(definition.Type)
+		if err != nil {
+			return nil, err
+		}
+		args, err := b.inputValues(definition.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		isDeprecated, reason := deprecation(definition.Directives)
+		fields = append(fields, &IntrospectionField{
+			Name:              definition.Name.Value,
+			Description:       description(definition.Description),
+			Args:              args,
+			Type:              fieldType,
+			IsDeprecated:      isDeprecated,
+			DeprecationReason: reason,
+		})
+	}
+	return fields, nil
+}
+
+func (b *sdlBuilder) inputValues(definitions []*ast.InputValueDefinition) ([]*IntrospectionInputValue, error) {
+	values := make([]*IntrospectionInputValue, 0, len(definitions))
+	for _, definition := range definitions {
+		valueType, err := b.typeRef(definition.Type)
+		if err != nil {
+			return nil, err
+		}
+		var defaultValue string
+		if definition.DefaultValue != nil {
+			defaultValue = fmt.Sprintf("%v", printer.Print(definition.DefaultValue))
+		}
+		isDeprecated, reason := deprecation(definition.Directives)
+		values = append(values, &IntrospectionInputValue{
+			Name:              definition.Name.Value,
+			Description:       description(definition.Description),
+			Type:              valueType,
+			DefaultValue:      defaultValue,
+			IsDeprecated:      isDeprecated,
+			DeprecationReason: reason,
+		})
+	}
+	return values, nil
+}
+
+func (b *sdlBuilder) directive(definition *ast.DirectiveDefinition) (*IntrospectionDirective, error) {
+	args, err := b.inputValues(definition.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]string, 0, len(definition.Locations))
+	for _, location := range definition.Locations {
+		locations = append(locations, location.Value)
+	}
+	return &IntrospectionDirective{
+		Name:         definition.Name.Value,
+		Description:  description(definition.Description),
+		Locations:    locations,
+		Args:         args,
+		IsRepeatable: b.repeatable[definition.Name.Value],
+	}, nil
+}
+
+func (b *sdlBuilder) typeRef(t ast.Type) (*IntrospectionTypeRef, error) {
+	ofType, err := b.ofType(t)
+	if err != nil {
+		return nil, err
+	}
+	return &IntrospectionTypeRef{
+		Kind:   ofType.Kind,
+		Name:   ofType.Name,
+		OfType: ofType.OfType,
+	}, nil
+}
+
+func (b *sdlBuilder) ofType(t ast.Type) (*IntrospectionOfType, error) {
+	switch t := t.(type) {
+	case *ast.NonNull:
+		ofType, err := b.ofType(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &IntrospectionOfType{Kind: "NON_NULL", OfType: ofType}, nil
+	case *ast.List:
+		ofType, err := b.ofType(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &IntrospectionOfType{Kind: "LIST", OfType: ofType}, nil
+	case *ast.Named:
+		kind, ok := b.kinds[t.Name.Value]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", t.Name.Value)
+		}
+		return &IntrospectionOfType{Kind: kind, Name: t.Name.Value}, nil
+	}
+	return nil, fmt.Errorf("unexpected type %s", t.String())
+}
+
+func description(value *ast.StringValue) string {
+	if value == nil {
+		return ""
+	}
+	return value.Value
+}
+
+// deprecation reads the @deprecated directive, whose reason defaults to the
+// one of the graphql specification.
+func deprecation(directives []*ast.Directive) (bool, string) {
+	if !hasDirective(directives, "deprecated") {
+		return false, ""
+	}
+	if reason, ok := directiveArgument(directives, "deprecated", "reason").(string); ok {
+		return true, reason
+	}
+	return true, defaultDeprecationReason
+}
+
+func hasDirective(directives []*ast.Directive, name string) bool {
+	for _, directive := range directives {
+		if directive.Name.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// directiveArgument returns the value of an argument of a directive, nil
+// when either is missing.
+func directiveArgument(directives []*ast.Directive, name string, arg string) interface{} {
+	for _, directive := range directives {
+		if directive.Name.Value != name {
+			continue
+		}
+		for _, argument := range directive.Arguments {
+			if argument.Name.Value == arg {
+				return argument.Value.GetValue()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package dgql_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/stretchr/testify/assert"
+)
+
+var recursiveSDL = `
+"""
+A person using the service
+"""
+type User {
+  name: String
+  friends: [User]
+}
+
+type Post {
+  title: String
+  author: User
+  tags: [Tag]
+}
+
+type Tag {
+  label: String
+}
+
+type Query {
+  me: User
+}
+
+extend type User {
+  posts: [Post]
+}
+`
+
+func TestNewClientFromSDL(t *testing.T) {
+	server := newTestServer(t, newRecursiveSchema(t))
+	client, err := dgql.NewClientFromSDL(server.URL, recursiveSDL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, _, err := client.Document(dgql.OperationQuery, "me")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query me { me { name posts { title } } }", document)
+	}
+	resp, _, err := client.Query(context.Background(), "me", nil, nil)
+	if !assert.NoError(t, err, "Error querying") {
+		return
+	}
+	assert.Equal(t, "hello", resp.Get("me.posts.0.title").String())
+}
+
+func TestParseSDL(t *testing.T) {
+	schema, err := dgql.ParseSDL(`
+schema {
+  query: RootQuery
+  mutation: RootMutation
+}
+
+interface Node {
+  id: ID!
+}
+
+type Product implements Node {
+  id: ID!
+  "the display name"
+  name: String @deprecated(reason: "use title")
+  title: String
+  status: Status
+}
+
+enum Status {
+  ACTIVE
+  RETIRED @deprecated
+}
+
+union SearchResult = Product
+
+input ProductInput {
+  title: String = "untitled"
+  ids: [[ID!]]!
+}
+
+type RootQuery {
+  node(id: ID!): Node
+  search(first: Int = 10): [SearchResult!]!
+}
+
+type RootMutation {
+  create(input: ProductInput!): Product
+}
+`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "RootQuery", schema.QueryType.Name)
+	assert.Equal(t, "RootMutation", schema.MutationType.Name)
+	assert.Nil(t, schema.SubscriptionType)
+	types := make(map[string]*dgql.IntrospectionType)
+	for _, t := range schema.Types {
+		types[t.Name] = t
+	}
+	assert.Equal(t, "Product", types["Node"].PossibleTypes[0].Name)
+	assert.Equal(t, "INTERFACE", types["Product"].Interfaces[0].Kind)
+	assert.Equal(t, "the display name", types["Product"].Fields[1].Description)
+	assert.True(t, types["Product"].Fields[1].IsDeprecated)
+	assert.Equal(t, "use title", types["Product"].Fields[1].DeprecationReason)
+	assert.Equal(t, "No longer supported", types["Status"].EnumValues[1].DeprecationReason)
+	assert.Equal(t, `"untitled"`, types["ProductInput"].InputFields[0].DefaultValue)
+	assert.Equal(t, "10", types["RootQuery"].Fields[1].Args[0].DefaultValue)
+	assert.Equal(t, "SCALAR", types["ID"].Kind)
+
+	client := (&dgql.Introspection{Schema: schema, Endpoint: "http://localhost"}).ParseSchema()
+	document, _, err := client.Document(dgql.OperationMutation, "create")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mutation create($input: ProductInput!) { create(input: $input) { id name title status } }", document)
+	}
+	document, _, err = client.Document(dgql.OperationQuery, "search")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query search($first: Int) { search(first: $first) { __typename ... on Product { id name title status } } }", document)
+	}
+
+	_, err = dgql.ParseSDL(`type Query { me: Missing }`)
+	assert.EqualError(t, err, "unknown type Missing")
+}
+
+func TestNewClientFromSDLFiles(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "types.graphql"), filepath.Join(dir, "query.graphql")}
+	assert.NoError(t, os.WriteFile(paths[0], []byte(`type Tag { label: String }`), 0644))
+	assert.NoError(t, os.WriteFile(paths[1], []byte(`type Query { tags: [Tag] }`), 0644))
+	client, err := dgql.NewClientFromSDLFiles("http://localhost", paths)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	document, _, err := client.Document(dgql.OperationQuery, "tags")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "query tags { tags { label } }", document)
+	}
+}
@@ -0,0 +1,111 @@
+package dgql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// SSE implements the distinct connections mode of the graphql-sse protocol,
+// https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md, every
+// subscription is a POST request answered with a text/event-stream.
+type SSE struct{}
+
+func (t *SSE) Connect(ctx context.Context, request *SubscriptionRequest) (SubscriptionStream, error) {
+	body, err := json.Marshal(request.payload())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, request.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header = request.Header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	client := http.DefaultClient
+	if request.HTTPClient != nil {
+		client = request.HTTPClient
+	}
+	// the timeout of the client would cut the stream off, it only bounds
+	// waiting for the response headers
+	streaming := *client
+	streaming.Timeout = 0
+	if client.Timeout > 0 {
+		timer := time.AfterFunc(client.Timeout, cancel)
+		defer timer.Stop()
+	}
+	resp, err := streaming.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("unexpected event stream response %s", resp.Status)
+	}
+	return &sseStream{
+		body:   resp.Body,
+		reader: bufio.NewReader(resp.Body),
+		cancel: cancel,
+	}, nil
+}
+
+type sseStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	cancel context.CancelFunc
+}
+
+// Next reads events until a next or complete event, other events like
+// keep-alive comments are skipped.
+func (s *sseStream) Next() (gjson.Result, error) {
+	var event string
+	var data []string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				// the stream ended without complete event
+				err = io.ErrUnexpectedEOF
+			}
+			return gjson.Result{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+			continue
+		}
+		switch event {
+		case "next":
+			return gjson.Parse(strings.Join(data, "\n")), nil
+		case "complete":
+			return gjson.Result{}, io.EOF
+		}
+		event = ""
+		data = nil
+	}
+}
+
+func (s *sseStream) Close() error {
+	s.cancel()
+	return s.body.Close()
+}
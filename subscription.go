@@ -0,0 +1,178 @@
+package dgql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// SubscriptionRequest is everything a SubscriptionTransport needs to start a
+// subscription.
+type SubscriptionRequest struct {
+	// Endpoint is the client's http endpoint, WebsocketEndpoint the websocket
+	// url derived from it or set with GraphqlClient.SubscriptionEndpoint.
+	Endpoint          string
+	WebsocketEndpoint string
+	Header            http.Header
+	// HTTPClient sends the requests of SSE, the websocket transports only use
+	// the tls configuration of its transport.
+	HTTPClient    *http.Client
+	Query         string
+	OperationName string
+	Variables     interface{}
+}
+
+func (r *SubscriptionRequest) payload() map[string]interface{} {
+	return map[string]interface{}{
+		"query":         r.Query,
+		"operationName": r.OperationName,
+		"variables":     r.Variables,
+	}
+}
+
+// SubscriptionTransport starts subscriptions over one particular protocol,
+// see GraphQLTransportWS, LegacyGraphQLWS and SSE.
+type SubscriptionTransport interface {
+	// Connect opens a connection and starts the subscription, the connection
+	// must be released once ctx is cancelled.
+	Connect(ctx context.Context, request *SubscriptionRequest) (SubscriptionStream, error)
+}
+
+// SubscriptionStream is a single started subscription.
+type SubscriptionStream interface {
+	// Next blocks until the next payload, {"data": ..., "errors": ...}, is
+	// received. It returns io.EOF once the server completed the subscription,
+	// any other error means the connection was lost.
+	Next() (gjson.Result, error)
+	// Close stops the subscription and releases the connection.
+	Close() error
+}
+
+// default reconnect behavior of Subscribe, see WithReconnect.
+const (
+	defaultReconnectAttempts = 5
+	defaultReconnectDelay    = 500 * time.Millisecond
+	maxReconnectDelay        = 30 * time.Second
+)
+
+// Subscribe starts a subscription with the client's SubscriptionTransport,
+// graphql-transport-ws unless configured otherwise. The payload of every
+// message, {"data": ..., "errors": ...}, is delivered on the returned channel
+// until ctx is cancelled or the server completes the subscription, then the
+// channel is closed. A subscription error from the server is delivered as
+// {"errors": [...]} before the channel is closed.
+//
+// When the connection is lost the subscription is started again on a new
+// connection, the channel is closed once reconnecting failed too often.
+func (c *GraphqlClient) Subscribe(ctx context.Context, operationName string, variables interface{}, headers *map[string]string, opts ...CallOption) (<-chan gjson.Result, error) {
+	document, err := c.document(OperationSubscription, operationName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	request := &SubscriptionRequest{
+		Endpoint:      c.Endpoint,
+		Header:        make(http.Header),
+		HTTPClient:    c.Client.GetClient(),
+		Query:         document,
+		OperationName: operationName,
+		Variables:     variables,
+	}
+	// the websocket endpoint is only needed by websocket transports, which
+	// report it missing themselves
+	request.WebsocketEndpoint, _ = c.subscriptionEndpoint()
+	for k, v := range c.DefaultHeaders {
+		request.Header.Set(k, v)
+	}
+	if headers != nil {
+		for k, v := range *headers {
+			request.Header.Set(k, v)
+		}
+	}
+	transport := c.subscriptionTransport
+	if transport == nil {
+		transport = &GraphQLTransportWS{}
+	}
+	stream, err := transport.Connect(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	results := make(chan gjson.Result)
+	go c.receive(ctx, transport, request, stream, results)
+	return results, nil
+}
+
+// receive delivers the payloads of stream and resubscribes whenever the
+// connection is lost.
+func (c *GraphqlClient) receive(ctx context.Context, transport SubscriptionTransport, request *SubscriptionRequest, stream SubscriptionStream, results chan<- gjson.Result) {
+	defer close(results)
+	attempts := 0
+	for {
+		result, err := stream.Next()
+		if err == nil {
+			attempts = 0
+			select {
+			case results <- result:
+				continue
+			case <-ctx.Done():
+				stream.Close()
+				return
+			}
+		}
+		stream.Close()
+		if err == io.EOF || ctx.Err() != nil {
+			return
+		}
+		for stream = nil; stream == nil; attempts++ {
+			if attempts >= c.reconnectAttempts {
+				return
+			}
+			delay := c.reconnectDelay << attempts
+			if delay > maxReconnectDelay || delay <= 0 {
+				delay = maxReconnectDelay
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			stream, _ = transport.Connect(ctx, request)
+		}
+	}
+}
+
+// subscriptionEndpoint returns SubscriptionEndpoint or Endpoint with its
+// http scheme replaced by the matching websocket scheme.
+func (c *GraphqlClient) subscriptionEndpoint() (string, error) {
+	if c.SubscriptionEndpoint != "" {
+		return c.SubscriptionEndpoint, nil
+	}
+	if strings.HasPrefix(c.Endpoint, "https://") {
+		return "wss://" + strings.TrimPrefix(c.Endpoint, "https://"), nil
+	}
+	if strings.HasPrefix(c.Endpoint, "http://") {
+		return "ws://" + strings.TrimPrefix(c.Endpoint, "http://"), nil
+	}
+	return "", fmt.Errorf("can not derive subscription endpoint from %s", c.Endpoint)
+}
+
+// errorsPayload wraps the errors of a subscription error message into a
+// payload like the ones of regular results.
+func errorsPayload(errors gjson.Result) gjson.Result {
+	raw := errors.Raw
+	if !errors.IsArray() {
+		raw = fmt.Sprintf("[%s]", raw)
+	}
+	payload, _ := json.Marshal(map[string]json.RawMessage{
+		"errors": json.RawMessage(raw),
+	})
+	return gjson.ParseBytes(payload)
+}
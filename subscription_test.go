@@ -0,0 +1,315 @@
+package dgql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sczlog/dgql"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"golang.org/x/net/websocket"
+)
+
+func newCounterSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"hello": &graphql.Field{Type: graphql.String},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"counter": &graphql.Field{
+					Type: graphql.Int,
+					Args: graphql.FieldConfigArgument{
+						"to": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						to := p.Args["to"].(int)
+						c := make(chan interface{})
+						go func() {
+							defer close(c)
+							for i := 1; i <= to || to == 0; i++ {
+								select {
+								case c <- i:
+								case <-p.Context.Done():
+									return
+								}
+							}
+						}()
+						return c, nil
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		}),
+	})
+	assert.NoError(t, err)
+	return schema
+}
+
+// subscribe runs the subscription of a request payload against schema and
+// hands every result to send until ctx is cancelled or the subscription ends.
+func subscribe(ctx context.Context, schema graphql.Schema, payload gjson.Result, send func(*graphql.Result) error) {
+	variables, _ := payload.Get("variables").Value().(map[string]interface{})
+	results := graphql.Subscribe(graphql.Params{
+		Context:        ctx,
+		Schema:         schema,
+		RequestString:  payload.Get("query").String(),
+		VariableValues: variables,
+		OperationName:  payload.Get("operationName").String(),
+	})
+	for result := range results {
+		if err := send(result); err != nil {
+			return
+		}
+	}
+}
+
+// newSubscriptionServer serves schema over http, over the graphql-transport-ws
+// and legacy graphql-ws websocket protocols and over graphql-sse on the same
+// endpoint. With drop the first connection is dropped after one result.
+func newSubscriptionServer(t *testing.T, schema graphql.Schema, drop bool) *httptest.Server {
+	server := httptest.NewServer(newSubscriptionHandler(schema, drop))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newSubscriptionHandler is the handler of newSubscriptionServer.
+func newSubscriptionHandler(schema graphql.Schema, drop bool) http.Handler {
+	graphqlHandler := newTestHandler(schema)
+	var connections int32
+	dropped := func() bool {
+		return drop && atomic.AddInt32(&connections, 1) == 1
+	}
+	wsServer := websocket.Server{
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			for _, protocol := range config.Protocol {
+				if protocol == "graphql-transport-ws" || protocol == "graphql-ws" {
+					config.Protocol = []string{protocol}
+					return nil
+				}
+			}
+			return websocket.ErrBadWebSocketProtocol
+		},
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+			legacy := conn.Config().Protocol[0] == "graphql-ws"
+			receive := func() gjson.Result {
+				var message string
+				websocket.Message.Receive(conn, &message)
+				return gjson.Parse(message)
+			}
+			if receive().Get("type").String() != "connection_init" {
+				return
+			}
+			if legacy {
+				websocket.JSON.Send(conn, map[string]interface{}{"type": "ka"})
+			} else {
+				// clients have to answer pings at any time
+				websocket.JSON.Send(conn, map[string]interface{}{"type": "ping"})
+				if receive().Get("type").String() != "pong" {
+					return
+				}
+			}
+			websocket.JSON.Send(conn, map[string]interface{}{"type": "connection_ack"})
+			start := receive()
+			id := start.Get("id").String()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				// the client stops the subscription when it is no longer interested
+				switch receive().Get("type").String() {
+				case "complete", "stop":
+					cancel()
+				}
+			}()
+			next, complete := "next", "complete"
+			if legacy {
+				next = "data"
+			}
+			drop := dropped()
+			subscribe(ctx, schema, start.Get("payload"), func(result *graphql.Result) error {
+				if err := websocket.JSON.Send(conn, map[string]interface{}{"id": id, "type": next, "payload": result}); err != nil {
+					return err
+				}
+				if drop {
+					return errors.New("drop")
+				}
+				return nil
+			})
+			if !drop {
+				websocket.JSON.Send(conn, map[string]interface{}{"id": id, "type": complete})
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") != "" {
+			wsServer.ServeHTTP(w, req)
+			return
+		}
+		if req.Header.Get("Accept") != "text/event-stream" {
+			graphqlHandler.ServeHTTP(w, req)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": keep-alive\n\n")
+		drop := dropped()
+		subscribe(req.Context(), schema, gjson.ParseBytes(body), func(result *graphql.Result) error {
+			data, _ := json.Marshal(result)
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+			w.(http.Flusher).Flush()
+			if drop {
+				return errors.New("drop")
+			}
+			return nil
+		})
+		if !drop {
+			fmt.Fprint(w, "event: complete\ndata:\n\n")
+		}
+	})
+}
+
+func collectCounter(t *testing.T, client *dgql.GraphqlClient, to int) []int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := client.Subscribe(ctx, "counter", map[string]interface{}{"to": to}, nil)
+	if !assert.NoError(t, err, "Error subscribing") {
+		return nil
+	}
+	counts := make([]int64, 0)
+	for result := range results {
+		counts = append(counts, result.Get("data.counter").Int())
+	}
+	return counts
+}
+
+func TestSubscribe(t *testing.T) {
+	server := newSubscriptionServer(t, newCounterSchema(t), false)
+	transports := map[string]dgql.SubscriptionTransport{
+		"graphql-transport-ws": &dgql.GraphQLTransportWS{},
+		"graphql-ws":           &dgql.LegacyGraphQLWS{},
+		"sse":                  &dgql.SSE{},
+	}
+	for name, transport := range transports {
+		t.Run(name, func(t *testing.T) {
+			client, err := dgql.NewClient(server.URL, dgql.WithSubscriptionTransport(transport))
+			if !assert.NoError(t, err, "Error creating client") {
+				return
+			}
+			assert.Equal(t, []int64{1, 2, 3}, collectCounter(t, client, 3))
+		})
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	transports := map[string]dgql.SubscriptionTransport{
+		"graphql-transport-ws": &dgql.GraphQLTransportWS{},
+		"graphql-ws":           &dgql.LegacyGraphQLWS{},
+		"sse":                  &dgql.SSE{},
+	}
+	for name, transport := range transports {
+		t.Run(name, func(t *testing.T) {
+			server := newSubscriptionServer(t, newCounterSchema(t), true)
+			client, err := dgql.NewClient(server.URL, dgql.WithSubscriptionTransport(transport), dgql.WithReconnect(3, time.Millisecond))
+			if !assert.NoError(t, err, "Error creating client") {
+				return
+			}
+			// the first connection is dropped after 1, the resubscription starts over
+			assert.Equal(t, []int64{1, 1, 2, 3}, collectCounter(t, client, 3))
+		})
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	server := newSubscriptionServer(t, newCounterSchema(t), false)
+	client, err := dgql.NewClient(server.URL)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := client.Subscribe(ctx, "counter", map[string]interface{}{"to": 0}, nil)
+	if !assert.NoError(t, err, "Error subscribing") {
+		cancel()
+		return
+	}
+	first := <-results
+	assert.Equal(t, int64(1), first.Get("data.counter").Int())
+	cancel()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-results:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("subscription was not closed after cancel")
+		}
+	}
+}
+
+func TestSubscribeTLS(t *testing.T) {
+	server := httptest.NewTLSServer(newSubscriptionHandler(newCounterSchema(t), false))
+	t.Cleanup(server.Close)
+	// the certificate of the server is only trusted by its client
+	client, err := dgql.NewClient(server.URL, dgql.WithHTTPClient(server.Client()), dgql.WithReconnect(0, 0))
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	assert.Equal(t, []int64{1, 2, 3}, collectCounter(t, client, 3))
+}
+
+func TestSSETimeout(t *testing.T) {
+	const schema = `
+		type Query { hello: String }
+		type Subscription { counter(to: Int!): Int }
+	`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/stall" {
+			// the disconnect of the client is only noticed once the body is read
+			io.ReadAll(req.Body)
+			<-req.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		// the stream outlasts the timeout of the client
+		for i := 1; i <= 3; i++ {
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintf(w, "event: next\ndata: {\"data\":{\"counter\":%d}}\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "event: complete\ndata:\n\n")
+	}))
+	t.Cleanup(server.Close)
+	opts := []dgql.Option{dgql.WithSubscriptionTransport(&dgql.SSE{}), dgql.WithTimeout(100 * time.Millisecond), dgql.WithReconnect(0, 0)}
+	client, err := dgql.NewClientFromSDL(server.URL, schema, opts...)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	assert.Equal(t, []int64{1, 2, 3}, collectCounter(t, client, 3))
+
+	// waiting for the response is still bounded by the timeout
+	client, err = dgql.NewClientFromSDL(server.URL+"/stall", schema, opts...)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	_, err = client.Subscribe(context.Background(), "counter", map[string]interface{}{"to": 3}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
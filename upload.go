@@ -0,0 +1,499 @@
+package dgql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tidwall/gjson"
+)
+
+// FileConfig is a file sent with UploadMutation or RawUpload as described by
+// https://github.com/jaydenseric/graphql-multipart-request-spec. Its content
+// is taken from Bytes, Reader or LocalPath, whichever is set.
+type FileConfig struct {
+	Bytes *[]byte
+	// Reader is read while the request is sent, so large files are never
+	// held in memory. It is not closed.
+	Reader io.Reader
+	// Size is the number of bytes of Reader. When it is zero the size is
+	// taken from a Len or Stat method of Reader, the request is sent without
+	// Content-Length if that fails too.
+	Size int64
+	// LocalPath is the path of a file on disk, it is opened when the request
+	// is sent.
+	LocalPath string
+	// Path is the dotted path of the Upload variable the file is sent as,
+	// e.g. "file", "input.avatar" or "files.0" for the first element of an
+	// [Upload!]! variable.
+	Path string
+	// Paths are further variable paths the same file is sent as, it is
+	// uploaded only once.
+	Paths []string
+	// Filename is the name of the uploaded file, by default the name of the
+	// file at LocalPath or of Reader if it has a Stat method, else "file".
+	Filename string
+	// ContentType is the media type of the file, application/octet-stream
+	// by default.
+	ContentType string
+	// Progress is called with the number of bytes sent of the file while it
+	// is uploaded, size is -1 when unknown.
+	Progress func(sent int64, size int64)
+}
+
+// paths returns all the variable paths of the file.
+func (f FileConfig) paths() []string {
+	paths := make([]string, 0, len(f.Paths)+1)
+	if f.Path != "" {
+		paths = append(paths, f.Path)
+	}
+	return append(paths, f.Paths...)
+}
+
+// RawUpload sends document as a multipart request with files. The body is
+// streamed, with Content-Length when the sizes of all files are known and
+// Client was created by dgql, see setContentLength.
+func (c *GraphqlClient) RawUpload(ctx context.Context, document string, operationName string, variables interface{}, headers *map[string]string, files []FileConfig) (*gjson.Result, *http.Header, error) {
+	mapping := make(map[string][]string)
+	var paths []string
+	uploads := make([]*upload, len(files))
+	for i, file := range files {
+		if len(file.paths()) == 0 {
+			return nil, nil, fmt.Errorf("file %d has no variable path", i)
+		}
+		for _, path := range file.paths() {
+			mapping[strconv.Itoa(i)] = append(mapping[strconv.Itoa(i)], "variables."+path)
+			paths = append(paths, path)
+		}
+		var err error
+		if uploads[i], err = newUpload(file); err != nil {
+			return nil, nil, fmt.Errorf("file %d: %w", i, err)
+		}
+	}
+	// the spec requires null at the positions of the files
+	variables, err := nullFiles(variables, paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	bOperations, err := json.Marshal(newOperations(document, operationName, variables))
+	if err != nil {
+		return nil, nil, err
+	}
+	bMapping, err := json.Marshal(mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := &multipartBody{
+		boundary:   multipart.NewWriter(io.Discard).Boundary(),
+		operations: bOperations,
+		mapping:    bMapping,
+		uploads:    uploads,
+	}
+
+	reader, writer := io.Pipe()
+	// closing the reader stops the writing goroutine when the request failed
+	defer reader.Close()
+	go func() {
+		writer.CloseWithError(body.write(writer))
+	}()
+	request := c.newRequest(ctx, headers).
+		SetHeader("Content-Type", "multipart/form-data; boundary="+body.boundary).
+		SetBody(reader)
+	if length := body.length(); length >= 0 {
+		request.SetHeader("Content-Length", strconv.FormatInt(length, 10))
+	}
+	resp, err := request.Post(c.Endpoint)
+	if err != nil {
+		return nil, nil, &TransportError{Err: err}
+	}
+	return parseResponse(resp.RawResponse, resp.Body())
+}
+
+// setContentLength makes client send streamed bodies with the length of
+// their Content-Length header, which net/http ignores otherwise and sends
+// them chunked. resty has a single pre request hook per client, so it is
+// only set on clients created by dgql.
+func setContentLength(client *resty.Client) {
+	client.SetPreRequestHook(func(_ *resty.Client, req *http.Request) error {
+		if req.ContentLength != 0 || req.Body == nil || req.Body == http.NoBody {
+			return nil
+		}
+		if length, err := strconv.ParseInt(req.Header.Get("Content-Length"), 10, 64); err == nil && length > 0 {
+			req.ContentLength = length
+		}
+		return nil
+	})
+}
+
+// upload is a file of an upload request with its size, -1 when unknown.
+type upload struct {
+	FileConfig
+	size int64
+}
+
+func newUpload(file FileConfig) (*upload, error) {
+	result := &upload{FileConfig: file, size: -1}
+	switch {
+	case file.Bytes != nil:
+		result.size = int64(len(*file.Bytes))
+	case file.LocalPath != "":
+		info, err := os.Stat(file.LocalPath)
+		if err != nil {
+			return nil, err
+		}
+		result.size = info.Size()
+		if result.Filename == "" {
+			result.Filename = info.Name()
+		}
+	case file.Reader != nil:
+		if file.Size > 0 {
+			result.size = file.Size
+		} else if reader, ok := file.Reader.(interface{ Len() int }); ok {
+			result.size = int64(reader.Len())
+		}
+		if reader, ok := file.Reader.(interface{ Stat() (fs.FileInfo, error) }); ok {
+			if info, err := reader.Stat(); err == nil {
+				if result.size < 0 && info.Mode().IsRegular() {
+					result.size = info.Size()
+				}
+				if result.Filename == "" {
+					result.Filename = info.Name()
+				}
+			}
+		}
+	default:
+		return nil, errors.New("no content, set Bytes, Reader or LocalPath")
+	}
+	return result, nil
+}
+
+// open returns the content of the file.
+func (u *upload) open() (io.ReadCloser, error) {
+	switch {
+	case u.Bytes != nil:
+		return io.NopCloser(bytes.NewReader(*u.Bytes)), nil
+	case u.LocalPath != "":
+		return os.Open(u.LocalPath)
+	}
+	return io.NopCloser(u.Reader), nil
+}
+
+// multipartBody is the body of an upload request, it is written part by part
+// so the files are never held in memory.
+type multipartBody struct {
+	boundary   string
+	operations []byte
+	mapping    []byte
+	uploads    []*upload
+}
+
+func (b *multipartBody) write(w io.Writer) error {
+	return b.writeParts(w, true)
+}
+
+// length returns the size of the body, -1 when the size of a file is
+// unknown.
+func (b *multipartBody) length() int64 {
+	var counter countingWriter
+	b.writeParts(&counter, false)
+	length := counter.n
+	for _, upload := range b.uploads {
+		if upload.size < 0 {
+			return -1
+		}
+		length += upload.size
+	}
+	return length
+}
+
+// writeParts writes the body, leaving the content of the files out unless
+// content is set.
+func (b *multipartBody) writeParts(w io.Writer, content bool) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+	if err := writer.WriteField("operations", string(b.operations)); err != nil {
+		return err
+	}
+	if err := writer.WriteField("map", string(b.mapping)); err != nil {
+		return err
+	}
+	for i, upload := range b.uploads {
+		part, err := writer.CreatePart(upload.header(strconv.Itoa(i)))
+		if err != nil {
+			return err
+		}
+		if content {
+			if err := upload.copyTo(part); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Close()
+}
+
+func (u *upload) copyTo(w io.Writer) error {
+	reader, err := u.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if u.Progress != nil {
+		w = &progressWriter{w: w, size: u.size, progress: u.Progress}
+	}
+	n, err := io.Copy(w, reader)
+	if err == nil && u.size >= 0 && n != u.size {
+		err = fmt.Errorf("%s: read %d bytes instead of %d", u.Filename, n, u.size)
+	}
+	return err
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// progressWriter reports the bytes written to w.
+type progressWriter struct {
+	w        io.Writer
+	sent     int64
+	size     int64
+	progress func(sent int64, size int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.sent += int64(n)
+	w.progress(w.sent, w.size)
+	return n, err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// header returns the header of the multipart part of the file.
+func (f FileConfig) header(name string) textproto.MIMEHeader {
+	filename := f.Filename
+	if filename == "" {
+		filename = "file"
+	}
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(name), quoteEscaper.Replace(filename)))
+	header.Set("Content-Type", contentType)
+	return header
+}
+
+// nullFiles returns the variables with null at every dotted path, creating
+// the objects and lists leading to it. The variables are converted to their
+// json representation for that.
+func nullFiles(variables interface{}, paths []string) (interface{}, error) {
+	if len(paths) == 0 {
+		return variables, nil
+	}
+	b, err := json.Marshal(variables)
+	if err != nil {
+		return nil, err
+	}
+	// numbers are kept as they are, e.g. int64 ids beyond float64 precision
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var result interface{}
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		result, err = setNull(result, strings.Split(path, "."))
+		if err != nil {
+			return nil, fmt.Errorf("invalid file path %s: %w", path, err)
+		}
+	}
+	return result, nil
+}
+
+func setNull(value interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	index, err := strconv.Atoi(path[0])
+	isIndex := err == nil && index >= 0
+	switch v := value.(type) {
+	case nil:
+		if isIndex {
+			return setNull([]interface{}{}, path)
+		}
+		return setNull(map[string]interface{}{}, path)
+	case map[string]interface{}:
+		element, err := setNull(v[path[0]], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[path[0]] = element
+		return v, nil
+	case []interface{}:
+		if !isIndex {
+			return nil, fmt.Errorf("%s is not a list index", path[0])
+		}
+		for len(v) <= index {
+			v = append(v, nil)
+		}
+		element, err := setNull(v[index], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[index] = element
+		return v, nil
+	}
+	return nil, fmt.Errorf("can not set %s of %v", path[0], value)
+}
+
+// File is the value of an Upload variable, UploadMutation finds it in the
+// variables and sends it as a file. Like FileConfig its content is taken
+// from Bytes, Reader or LocalPath.
+type File struct {
+	Bytes       []byte
+	Reader      io.Reader
+	Size        int64
+	LocalPath   string
+	Filename    string
+	ContentType string
+	Progress    func(sent int64, size int64)
+}
+
+// MarshalJSON encodes the file as null, which is its value in the variables
+// of a multipart request.
+func (f File) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func (f File) config(path string) FileConfig {
+	config := FileConfig{
+		Reader:      f.Reader,
+		Size:        f.Size,
+		LocalPath:   f.LocalPath,
+		Path:        path,
+		Filename:    f.Filename,
+		ContentType: f.ContentType,
+		Progress:    f.Progress,
+	}
+	if f.Bytes != nil {
+		config.Bytes = &f.Bytes
+	}
+	return config
+}
+
+var fileType = reflect.TypeOf(File{})
+
+// files finds the File values in the variables of an operation, maps or
+// structs with json tags, by following the types of its arguments. A File is
+// accepted wherever a custom scalar like Upload is expected.
+func (s *Schema) files(operation string, operationName string, variables interface{}) ([]FileConfig, error) {
+	var files []FileConfig
+	value := reflect.ValueOf(variables)
+	for _, arg := range s.variables(operation, operationName) {
+		if member, ok := jsonMember(value, arg.Name); ok {
+			if err := s.walkFiles(member, arg.Type, arg.Name, &files); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+func (s *Schema) walkFiles(value reflect.Value, t *TypeRef, path string, files *[]FileConfig) error {
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+	if value.Type() == fileType {
+		if named := t.Named(); named.Kind != "SCALAR" || contains(builtinScalars, named.Name) {
+			return fmt.Errorf("variable %s of type %s can not be a file", path, t)
+		}
+		*files = append(*files, value.Interface().(File).config(path))
+		return nil
+	}
+	switch t.Kind {
+	case "NON_NULL":
+		return s.walkFiles(value, t.OfType, path, files)
+	case "LIST":
+		if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+			// a single value is accepted for a list
+			return s.walkFiles(value, t.OfType, path, files)
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := s.walkFiles(value.Index(i), t.OfType, fmt.Sprintf("%s.%d", path, i), files); err != nil {
+				return err
+			}
+		}
+	case "INPUT_OBJECT":
+		for _, field := range s.inputObjects[t.Name] {
+			if member, ok := jsonMember(value, field.Name); ok {
+				if err := s.walkFiles(member, field.Type, path+"."+field.Name, files); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonMember returns the value encoding/json would write under name for a
+// map or struct.
+func jsonMember(value reflect.Value, name string) (reflect.Value, bool) {
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return reflect.Value{}, false
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		member := value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+		return member, member.IsValid()
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if fieldName == "-" {
+				continue
+			}
+			if fieldName == "" {
+				fieldName = field.Name
+			}
+			if fieldName == name {
+				return value.Field(i), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
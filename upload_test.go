@@ -0,0 +1,267 @@
+package dgql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Sczlog/dgql"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// newUploadServer echoes a multipart upload request as the data of its
+// response: {"operations": ..., "map": ..., "files": {"0": {...}},
+// "contentLength": ...}.
+func newUploadServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reader, err := req.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data := map[string]interface{}{}
+		files := map[string]interface{}{}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			content, _ := io.ReadAll(part)
+			switch part.FormName() {
+			case "operations", "map":
+				var value interface{}
+				if err := json.Unmarshal(content, &value); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(err.Error()))
+					return
+				}
+				data[part.FormName()] = value
+			default:
+				files[part.FormName()] = map[string]string{
+					"filename":    part.FileName(),
+					"contentType": part.Header.Get("Content-Type"),
+					"content":     string(content),
+				}
+			}
+		}
+		data["files"] = files
+		data["contentLength"] = req.ContentLength
+		data["authorization"] = req.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newUploadClient creates a client for newUploadServer, which accepts any
+// document.
+func newUploadClient(t *testing.T, server *httptest.Server, opts ...dgql.Option) *dgql.GraphqlClient {
+	client, err := dgql.NewClientFromSDL(server.URL, "type Query { ok: String } type Mutation { upload: String }", opts...)
+	if !assert.NoError(t, err, "Error creating client") {
+		return nil
+	}
+	return client
+}
+
+func TestRawUploadEscaping(t *testing.T) {
+	server := newUploadServer(t)
+	client := newUploadClient(t, server)
+	if client == nil {
+		return
+	}
+	document := "mutation upload($file: Upload!, $note: String = \"a \\\"quoted\\\" \\\\ note\") {\n\tupload(file: $file, note: $note) # café ☕\n}"
+	content := []byte("hello")
+	resp, _, err := client.RawUpload(context.Background(), document, "upload", map[string]interface{}{"file": nil, "note": "naïve \"日本\""}, nil, []dgql.FileConfig{
+		{Bytes: &content, Path: "file"},
+	})
+	if !assert.NoError(t, err, "Error uploading") {
+		return
+	}
+	assert.Equal(t, document, resp.Get("operations.query").String())
+	assert.Equal(t, "upload", resp.Get("operations.operationName").String())
+	assert.Equal(t, "naïve \"日本\"", resp.Get("operations.variables.note").String())
+	assert.Equal(t, `["variables.file"]`, resp.Get("map.0").Raw)
+	assert.Equal(t, "hello", resp.Get("files.0.content").String())
+}
+
+func TestUploadMultipartSpec(t *testing.T) {
+	server := newUploadServer(t)
+	client := newUploadClient(t, server)
+	if client == nil {
+		return
+	}
+	avatar := []byte("<svg/>")
+	first, second := []byte("first"), []byte("second")
+	variables := map[string]interface{}{
+		"id":    int64(9007199254740993),
+		"input": map[string]interface{}{"name": "dgql"},
+	}
+	resp, _, err := client.RawUpload(context.Background(), "mutation upload { upload }", "upload", variables, nil, []dgql.FileConfig{
+		{Bytes: &avatar, Path: "input.avatar", Paths: []string{"input.thumbnail"}, Filename: `"avatar".svg`, ContentType: "image/svg+xml"},
+		{Bytes: &first, Path: "files.0", Filename: "first.txt"},
+		{Bytes: &second, Path: "files.1"},
+	})
+	if !assert.NoError(t, err, "Error uploading") {
+		return
+	}
+	assert.JSONEq(t, `{
+		"id": 9007199254740993,
+		"input": {"name": "dgql", "avatar": null, "thumbnail": null},
+		"files": [null, null]
+	}`, resp.Get("operations.variables").Raw)
+	assert.JSONEq(t, `{
+		"0": ["variables.input.avatar", "variables.input.thumbnail"],
+		"1": ["variables.files.0"],
+		"2": ["variables.files.1"]
+	}`, resp.Get("map").Raw)
+	assert.JSONEq(t, `{
+		"0": {"filename": "\"avatar\".svg", "contentType": "image/svg+xml", "content": "<svg/>"},
+		"1": {"filename": "first.txt", "contentType": "application/octet-stream", "content": "first"},
+		"2": {"filename": "file", "contentType": "application/octet-stream", "content": "second"}
+	}`, resp.Get("files").Raw)
+	// the variables of the caller are left as they are
+	assert.Equal(t, map[string]interface{}{"name": "dgql"}, variables["input"])
+
+	_, _, err = client.RawUpload(context.Background(), "mutation upload { upload }", "upload", variables, nil, []dgql.FileConfig{
+		{Bytes: &first, Path: "input.name.0"},
+	})
+	assert.EqualError(t, err, "invalid file path input.name.0: can not set 0 of dgql")
+}
+
+func TestStreamingUpload(t *testing.T) {
+	server := newUploadServer(t)
+	client := newUploadClient(t, server)
+	if client == nil {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	video := bytes.Repeat([]byte("0123456789"), 100000)
+	if !assert.NoError(t, os.WriteFile(path, video, 0644)) {
+		return
+	}
+	var progress []int64
+	var size int64
+	resp, _, err := client.RawUpload(context.Background(), "mutation upload { upload }", "upload", nil, nil, []dgql.FileConfig{
+		{LocalPath: path, Path: "video", Progress: func(sent int64, total int64) {
+			progress = append(progress, sent)
+			size = total
+		}},
+		{Reader: strings.NewReader("caption"), Path: "caption", ContentType: "text/plain"},
+	})
+	if !assert.NoError(t, err, "Error uploading") {
+		return
+	}
+	assert.Equal(t, "video.mp4", resp.Get("files.0.filename").String())
+	assert.Equal(t, len(video), len(resp.Get("files.0.content").String()))
+	assert.Equal(t, "caption", resp.Get("files.1.content").String())
+	// all sizes are known, so is the length of the body
+	assert.Greater(t, resp.Get("contentLength").Int(), int64(len(video)))
+	assert.Equal(t, int64(len(video)), size)
+	if assert.Greater(t, len(progress), 1) {
+		assert.Equal(t, int64(len(video)), progress[len(progress)-1])
+	}
+
+	// a reader of unknown size is sent chunked
+	resp, _, err = client.RawUpload(context.Background(), "mutation upload { upload }", "upload", nil, nil, []dgql.FileConfig{
+		{Reader: io.MultiReader(strings.NewReader("chunked "), strings.NewReader("content")), Path: "file", Progress: func(sent int64, total int64) {
+			size = total
+		}},
+	})
+	if !assert.NoError(t, err, "Error uploading") {
+		return
+	}
+	assert.Equal(t, "chunked content", resp.Get("files.0.content").String())
+	assert.Equal(t, int64(-1), resp.Get("contentLength").Int())
+	assert.Equal(t, int64(-1), size)
+
+	_, _, err = client.RawUpload(context.Background(), "mutation upload { upload }", "upload", nil, nil, []dgql.FileConfig{
+		{LocalPath: filepath.Join(t.TempDir(), "missing"), Path: "file"},
+	})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestUploadFilesInVariables(t *testing.T) {
+	server := newUploadServer(t)
+	client, err := dgql.NewClientFromSDL(server.URL, `
+		scalar Upload
+		input AttachmentInput { caption: String file: Upload! }
+		input PostInput { title: String attachments: [AttachmentInput!] cover: Upload }
+		type Mutation { createPost(input: PostInput!, files: [Upload!]!, avatar: Upload): String }
+		type Query { ok: String }
+	`)
+	if !assert.NoError(t, err, "Error creating client") {
+		return
+	}
+	type attachment struct {
+		Caption string     `json:"caption"`
+		File    *dgql.File `json:"file"`
+	}
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"title": "post",
+			"attachments": []attachment{
+				{Caption: "first", File: &dgql.File{Bytes: []byte("first"), Filename: "first.txt"}},
+				{Caption: "second", File: &dgql.File{Reader: strings.NewReader("second"), ContentType: "text/plain"}},
+			},
+		},
+		"files":  []dgql.File{{Bytes: []byte("a")}, {Bytes: []byte("b")}},
+		"avatar": nil,
+	}
+	resp, _, err := client.UploadMutation(context.Background(), "createPost", variables, nil, nil)
+	if !assert.NoError(t, err, "Error uploading") {
+		return
+	}
+	assert.JSONEq(t, `{
+		"0": ["variables.input.attachments.0.file"],
+		"1": ["variables.input.attachments.1.file"],
+		"2": ["variables.files.0"],
+		"3": ["variables.files.1"]
+	}`, resp.Get("map").Raw)
+	assert.JSONEq(t, `{
+		"input": {"title": "post", "attachments": [{"caption": "first", "file": null}, {"caption": "second", "file": null}]},
+		"files": [null, null],
+		"avatar": null
+	}`, resp.Get("operations.variables").Raw)
+	assert.Equal(t, "first.txt", resp.Get("files.0.filename").String())
+	assert.Equal(t, "text/plain", resp.Get("files.1.contentType").String())
+	assert.Equal(t, "b", resp.Get("files.3.content").String())
+
+	_, _, err = client.UploadMutation(context.Background(), "createPost", map[string]interface{}{
+		"input": map[string]interface{}{"title": dgql.File{Bytes: []byte("title")}},
+	}, nil, nil)
+	assert.EqualError(t, err, "variable input.title of type String can not be a file")
+}
+
+func TestUploadWithRestyClient(t *testing.T) {
+	server := newUploadServer(t)
+	restyClient := resty.New().SetAuthToken("secret")
+	client := newUploadClient(t, server, dgql.WithRestyClient(restyClient))
+	if client == nil {
+		return
+	}
+	resp, _, err := client.RawUpload(context.Background(), "mutation upload { upload }", "upload", nil, nil, []dgql.FileConfig{
+		{Reader: strings.NewReader("content"), Path: "file"},
+	})
+	if !assert.NoError(t, err, "Error uploading") {
+		return
+	}
+	// the request goes through resty like every other one
+	assert.Equal(t, "Bearer secret", resp.Get("authorization").String())
+	assert.Equal(t, "content", resp.Get("files.0.content").String())
+	// the pre request hook setting Content-Length is left to the owner of the
+	// client, so the body is sent chunked
+	assert.Equal(t, int64(-1), resp.Get("contentLength").Int())
+}
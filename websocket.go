@@ -0,0 +1,314 @@
+package dgql
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"golang.org/x/net/websocket"
+)
+
+// connectionAckTimeout bounds how long the server may take to acknowledge
+// connection_init before Connect gives up.
+const connectionAckTimeout = 10 * time.Second
+
+// GraphQLTransportWS implements the graphql-transport-ws subprotocol of
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+type GraphQLTransportWS struct {
+	// InitPayload is sent with connection_init, usually for authentication.
+	InitPayload map[string]interface{}
+}
+
+// LegacyGraphQLWS implements the graphql-ws subprotocol of
+// https://github.com/apollographql/subscriptions-transport-ws/blob/master/PROTOCOL.md
+type LegacyGraphQLWS struct {
+	// InitPayload is sent with connection_init, usually for authentication.
+	InitPayload map[string]interface{}
+}
+
+type wsMessage struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// subscriptionID is the id of the only operation started on a connection.
+const subscriptionID = "1"
+
+func (t *GraphQLTransportWS) Connect(ctx context.Context, request *SubscriptionRequest) (SubscriptionStream, error) {
+	conn, err := dialWebsocket(ctx, request, "graphql-transport-ws")
+	if err != nil {
+		return nil, err
+	}
+	s := &transportWSStream{wsConn: conn}
+	err = conn.init(t.InitPayload, func(message gjson.Result) (bool, error) {
+		switch message.Get("type").String() {
+		case "connection_ack":
+			return true, nil
+		case "ping":
+			return false, conn.send(wsMessage{Type: "pong"})
+		case "pong":
+			return false, nil
+		}
+		return false, fmt.Errorf("unexpected message %s", message.Raw)
+	})
+	if err == nil {
+		err = conn.send(wsMessage{ID: subscriptionID, Type: "subscribe", Payload: request.payload()})
+	}
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	go conn.watch(ctx, s.Close)
+	return s, nil
+}
+
+type transportWSStream struct {
+	*wsConn
+	// finished is set once the server ended the subscription
+	finished atomic.Bool
+}
+
+func (s *transportWSStream) Next() (gjson.Result, error) {
+	if s.finished.Load() {
+		return gjson.Result{}, io.EOF
+	}
+	for {
+		message, err := s.read()
+		if err != nil {
+			return gjson.Result{}, err
+		}
+		switch message.Get("type").String() {
+		case "next":
+			return message.Get("payload"), nil
+		case "error":
+			s.finished.Store(true)
+			return errorsPayload(message.Get("payload")), nil
+		case "complete":
+			s.finished.Store(true)
+			return gjson.Result{}, io.EOF
+		case "ping":
+			if err := s.send(wsMessage{Type: "pong"}); err != nil {
+				return gjson.Result{}, err
+			}
+		}
+	}
+}
+
+func (s *transportWSStream) Close() error {
+	if !s.finished.Load() {
+		s.send(wsMessage{ID: subscriptionID, Type: "complete"})
+	}
+	return s.close()
+}
+
+func (t *LegacyGraphQLWS) Connect(ctx context.Context, request *SubscriptionRequest) (SubscriptionStream, error) {
+	conn, err := dialWebsocket(ctx, request, "graphql-ws")
+	if err != nil {
+		return nil, err
+	}
+	s := &legacyWSStream{wsConn: conn}
+	err = conn.init(t.InitPayload, func(message gjson.Result) (bool, error) {
+		switch message.Get("type").String() {
+		case "connection_ack":
+			return true, nil
+		case "ka":
+			return false, nil
+		case "connection_error":
+			return false, fmt.Errorf("connection error %s", message.Get("payload").Raw)
+		}
+		return false, fmt.Errorf("unexpected message %s", message.Raw)
+	})
+	if err == nil {
+		err = conn.send(wsMessage{ID: subscriptionID, Type: "start", Payload: request.payload()})
+	}
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	go conn.watch(ctx, s.Close)
+	return s, nil
+}
+
+type legacyWSStream struct {
+	*wsConn
+	// finished is set once the server ended the subscription
+	finished atomic.Bool
+}
+
+func (s *legacyWSStream) Next() (gjson.Result, error) {
+	if s.finished.Load() {
+		return gjson.Result{}, io.EOF
+	}
+	for {
+		message, err := s.read()
+		if err != nil {
+			return gjson.Result{}, err
+		}
+		switch message.Get("type").String() {
+		case "data":
+			return message.Get("payload"), nil
+		case "error":
+			s.finished.Store(true)
+			return errorsPayload(message.Get("payload")), nil
+		case "complete":
+			s.finished.Store(true)
+			return gjson.Result{}, io.EOF
+		case "connection_error":
+			return gjson.Result{}, fmt.Errorf("connection error %s", message.Get("payload").Raw)
+		}
+	}
+}
+
+func (s *legacyWSStream) Close() error {
+	if !s.finished.Load() {
+		s.send(wsMessage{ID: subscriptionID, Type: "stop"})
+	}
+	s.send(wsMessage{Type: "connection_terminate"})
+	return s.close()
+}
+
+// wsConn is a websocket connection shared by a stream and the goroutine
+// closing it when the context is cancelled.
+type wsConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+	// closed is closed by the first call to close
+	closed chan struct{}
+	once   sync.Once
+}
+
+// dialWebsocket opens the websocket connection, unlike websocket.DialConfig
+// the tcp and tls handshakes are aborted when ctx is cancelled. The tls
+// configuration of the client's http transport is used, its proxy is not.
+func dialWebsocket(ctx context.Context, request *SubscriptionRequest, protocol string) (*wsConn, error) {
+	if request.WebsocketEndpoint == "" {
+		return nil, errors.New("subscription endpoint not set")
+	}
+	config, err := websocket.NewConfig(request.WebsocketEndpoint, request.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{protocol}
+	config.Header = request.Header.Clone()
+	var dialer net.Dialer
+	host := config.Location.Host
+	if config.Location.Port() == "" {
+		if config.Location.Scheme == "wss" {
+			host = net.JoinHostPort(config.Location.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(config.Location.Hostname(), "80")
+		}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if config.Location.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if transport, ok := httpTransport(request.HTTPClient); ok && transport.TLSClientConfig != nil {
+			tlsConfig = transport.TLSClientConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = config.Location.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	// the websocket handshake itself has no context, bound it by ctx's deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{
+		conn:   ws,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// httpTransport returns the transport of client when it is an http.Transport.
+func httpTransport(client *http.Client) (*http.Transport, bool) {
+	if client == nil || client.Transport == nil {
+		transport, ok := http.DefaultTransport.(*http.Transport)
+		return transport, ok
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	return transport, ok
+}
+
+func (c *wsConn) send(message wsMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return websocket.JSON.Send(c.conn, message)
+}
+
+func (c *wsConn) read() (gjson.Result, error) {
+	var message string
+	if err := websocket.Message.Receive(c.conn, &message); err != nil {
+		if err == io.EOF {
+			// io.EOF is reserved for completed subscriptions
+			err = io.ErrUnexpectedEOF
+		}
+		return gjson.Result{}, err
+	}
+	return gjson.Parse(message), nil
+}
+
+// init sends connection_init and passes every message to acked until it
+// reports the connection as acknowledged.
+func (c *wsConn) init(payload map[string]interface{}, acked func(gjson.Result) (bool, error)) error {
+	if err := c.send(wsMessage{Type: "connection_init", Payload: payload}); err != nil {
+		return err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(connectionAckTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	for {
+		message, err := c.read()
+		if err != nil {
+			return err
+		}
+		ok, err := acked(message)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// watch calls stop once ctx is cancelled unless the connection is closed
+// before.
+func (c *wsConn) watch(ctx context.Context, stop func() error) {
+	select {
+	case <-ctx.Done():
+		stop()
+	case <-c.closed:
+	}
+}
+
+func (c *wsConn) close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+	return err
+}